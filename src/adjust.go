@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// interval and break durations change by this much when the inline + and - keys have no duration
+const adjustStep = 5 * time.Minute
+
+// time the snooze command and notification action put off the next phase by default
+const snoozeStep = 5 * time.Minute
+
+var errNotRunning = errors.New("timer is not running")
+
+// length of the interval or break in progress
+func (s *State) PhaseLength() time.Duration {
+	if s.TimerOnBreak() {
+		return s.GetBreak()
+	}
+	return s.GetInterval()
+}
+
+// lengthen the interval or break in progress
+func (t *Task) Extend(d time.Duration) error {
+	if t.State.TimerIsStopped() || t.State.TimerHasExpired() {
+		return errNotRunning
+	}
+	if t.State.Stopwatch {
+		return errStopwatch
+	}
+	if d <= 0 {
+		return fmt.Errorf("'%v' invalid: extend by a positive duration", d)
+	}
+	t.addToPhase(d)
+	return t.saveAdjusted(fmt.Sprintf("extend %v", d))
+}
+
+// cut the interval or break in progress short, at most until it ends now
+func (t *Task) Shorten(d time.Duration) error {
+	if t.State.TimerIsStopped() || t.State.TimerHasExpired() {
+		return errNotRunning
+	}
+	if t.State.Stopwatch {
+		return errStopwatch
+	}
+	if d <= 0 {
+		return fmt.Errorf("'%v' invalid: shorten by a positive duration", d)
+	}
+	if remaining := t.State.GetRemaining(); d > remaining {
+		d = remaining
+	}
+	t.addToPhase(-d)
+	return t.saveAdjusted(fmt.Sprintf("shorten %v", d))
+}
+
+// set the time already spent in the interval or break in progress, e.g. when the timer was started
+// late; the phase keeps its length. On break the break start moves through the break offset, the
+// interval end already fired is left alone
+func (t *Task) AdjustElapsed(d time.Duration) error {
+	if t.State.TimerIsStopped() || t.State.TimerHasExpired() {
+		return errNotRunning
+	}
+	if d < 0 {
+		return fmt.Errorf("'%v' invalid: elapsed time can not be negative", d)
+	}
+	if t.State.Stopwatch {
+		t.State.SetStart(t.State.TimeStart.Add(t.State.GetStopwatchElapsed() - d))
+		return t.saveAdjusted(fmt.Sprintf("elapsed %v", d))
+	}
+	length := t.State.PhaseLength()
+	if d > length {
+		d = length
+	}
+	elapsed := length - t.State.GetRemaining()
+	if t.State.TimerOnBreak() {
+		t.State.BreakOffset += d - elapsed
+	} else {
+		t.State.SetStart(t.State.TimeStart.Add(elapsed - d))
+	}
+	return t.saveAdjusted(fmt.Sprintf("elapsed %v", d))
+}
+
+// changes made while on break only move the end of the break
+func (t *Task) addToPhase(d time.Duration) {
+	if t.State.TimerOnBreak() {
+		t.State.BreakExtra += d
+		return
+	}
+	t.State.IntervalExtra += d
+}
+
+// put off the phase that follows: the interval or break in progress is extended, and a timer that
+// has just completed runs its break for d more from now
+func (t *Task) Snooze(d time.Duration) error {
+	if t.State.TimerIsStopped() {
+		return errNotRunning
+	}
+	if t.State.Stopwatch {
+		return errStopwatch
+	}
+	if t.State.InRoutine() {
+		return errors.New("snooze is not available in routines")
+	}
+	if d <= 0 {
+		return fmt.Errorf("'%v' invalid: snooze by a positive duration", d)
+	}
+	t.State.EndPause()
+	if t.State.TimerHasExpired() {
+		t.State.BreakExtra += time.Since(t.State.GetBreakEnd()) + d
+	} else {
+		t.addToPhase(d) // on break only the break is extended, the interval end is already fired
+	}
+	return t.saveAdjusted(fmt.Sprintf("snooze %v", d))
+}
+
+// end the interval or break in progress now and count it as completed, the following phase starts
+// as if it had ended on its own
+func (t *Task) Finish() error {
+	if t.State.TimerIsStopped() || t.State.TimerHasExpired() {
+		return errNotRunning
+	}
+	if t.State.Stopwatch {
+		return errStopwatch
+	}
+	t.State.EndPause()
+	t.addToPhase(-t.State.GetRemaining())
+	err := t.saveAdjusted("finish")
+	if err != nil {
+		return err
+	}
+	t.transition()
+	return nil
+}
+
+// leave the interval or break in progress without completing it and move to the next phase; a
+// skipped break always goes back to work
+func (t *Task) Skip() error {
+	if t.State.TimerIsStopped() || t.State.TimerHasExpired() {
+		return errNotRunning
+	}
+	if t.State.Stopwatch {
+		return errStopwatch
+	}
+	onBreak := t.State.TimerOnBreak()
+	t.EndSession() // the skipped interval or break is recorded as stopped early
+	t.State.SetPause(time.Time{})
+	t.State.ClearUntil()
+	if onBreak {
+		t.State.Recorded = phaseBreak
+		t.State.SetStart(time.Now().Add(-t.State.GetInterval() - t.State.GetBreakLeft()))
+	} else {
+		t.State.Recorded = phaseWork
+		t.State.SetStart(time.Now().Add(-t.State.GetInterval()))
+	}
+	err := t.saveAdjusted("skip")
+	if err != nil {
+		return err
+	}
+	t.transition()
+	if onBreak && t.State.TimerHasExpired() && !t.State.InRoutine() {
+		return t.Start()
+	}
+	return nil
+}
+
+// start the interval or break in progress over from zero
+func (t *Task) Reset() error {
+	if t.State.TimerIsStopped() || t.State.TimerHasExpired() {
+		return errNotRunning
+	}
+	onBreak := t.State.TimerOnBreak()
+	t.EndSession()
+	t.State.SetPause(time.Time{})
+	t.State.ClearUntil() // the phase starts over at its full length
+	t.State.Laps = nil
+	if onBreak {
+		t.State.Recorded = phaseWork // the interval before the break is already recorded
+		t.State.BreakOffset = 0
+		t.State.SetStart(time.Now().Add(-t.State.GetInterval()))
+		t.State.NotifiedInterval = t.State.GetWorkEnd() // the interval end is not fired again
+	} else {
+		t.State.SetStart(time.Now())
+	}
+	return t.saveAdjusted("reset")
+}
+
+// record the phase that just ended and fire its event, as a natural end would
+func (t *Task) transition() {
+	if t.RecordSessions() {
+		t.State.Save()
+	}
+	t.UpdateEvents()
+}
+
+func (t *Task) saveAdjusted(message string) error {
+	err := t.State.Save()
+	if err != nil {
+		t.State.Debug.Print("saveAdjusted()", err)
+		return err
+	}
+	t.Message(message)
+	return nil
+}
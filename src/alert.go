@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// comma separated alert thresholds before the end of an interval or break, e.g. 5m,1m; 0 disables
+// alerts
+type AlertValue struct {
+	Thresholds []time.Duration
+	set        bool
+}
+
+func (v *AlertValue) String() string {
+	if len(v.Thresholds) == 0 {
+		return "0s"
+	}
+	var values []string
+	for _, d := range v.Thresholds {
+		values = append(values, d.String())
+	}
+	return strings.Join(values, ",")
+}
+
+func (v *AlertValue) Set(value string) error {
+	thresholds, err := ParseAlerts(value)
+	if err != nil {
+		return err
+	}
+	v.Thresholds, v.set = thresholds, true
+	return nil
+}
+
+func (v *AlertValue) IsSet() bool { return v.set }
+
+// value passed in a request
+func (v *AlertValue) Arg() string { return v.String() }
+
+// parse comma separated thresholds, longest first without duplicates; zero thresholds are dropped
+func ParseAlerts(value string) ([]time.Duration, error) {
+	var thresholds []time.Duration
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		d, err := time.ParseDuration(field)
+		if err != nil {
+			return nil, err
+		}
+		if d < 0 {
+			return nil, fmt.Errorf("negative alert threshold: %v", field)
+		}
+		if d > 0 {
+			thresholds = append(thresholds, d)
+		}
+	}
+	sort.Slice(thresholds, func(i, j int) bool { return thresholds[i] > thresholds[j] })
+	var unique []time.Duration
+	for _, d := range thresholds {
+		if len(unique) == 0 || d != unique[len(unique)-1] {
+			unique = append(unique, d)
+		}
+	}
+	return unique, nil
+}
+
+// alert thresholds, longest first; states saved before thresholds were added only hold one
+func (s *State) GetAlerts() []time.Duration {
+	if len(s.Alerts) == 0 && s.TimeAlert > 0 {
+		return []time.Duration{s.TimeAlert}
+	}
+	return s.Alerts
+}
+
+// the longest threshold is kept as the alert window that changes the icon and theme
+func (s *State) SetAlerts(thresholds []time.Duration) {
+	s.Alerts = thresholds
+	s.TimeAlert = 0
+	if len(thresholds) > 0 {
+		s.TimeAlert = thresholds[0]
+	}
+}
+
+// wall clock times the thresholds are reached in the running interval or break, earliest first;
+// thresholds as long as the phase are skipped, they would fire with its start
+func (s *State) alertTimes() ([]time.Duration, []time.Time) {
+	if s.TimerIsStopped() || s.TimerIsPaused() || s.TimerHasExpired() || s.Stopwatch {
+		return nil, nil
+	}
+	end, length := s.GetWorkEnd(), s.GetInterval()
+	if s.TimerOnBreak() {
+		end, length = s.GetBreakEnd(), s.GetBreak()
+	}
+	var thresholds []time.Duration
+	var times []time.Time
+	for _, d := range s.GetAlerts() {
+		if d < length {
+			thresholds = append(thresholds, d)
+			times = append(times, end.Add(-d))
+		}
+	}
+	return thresholds, times
+}
+
+// latest threshold reached in the running interval or break, 0 when none is reached
+func (s *State) ReachedAlert() time.Duration {
+	thresholds, times := s.alertTimes()
+	now := time.Now()
+	for i := len(times) - 1; i >= 0; i-- {
+		if !times[i].After(now) {
+			return thresholds[i]
+		}
+	}
+	return 0
+}
+
+// identifies the running interval or break, alerts fired in it are recorded against it; resuming
+// moves the start by the pause, which is taken back out, and changes to its length do not change it
+func (s *State) alertPhase() string {
+	phase := s.TimeStart.Add(-s.PausedInterval - s.PausedBreak).Format(time.RFC3339Nano)
+	if s.TimerOnBreak() {
+		return phase + " break"
+	}
+	return phase
+}
+
+// true when the latest threshold reached has not fired in the running interval or break; the
+// thresholds fire from longest to shortest, so one shorter than the last fired is new
+func (s *State) AlertDue() bool {
+	d := s.ReachedAlert()
+	if d == 0 {
+		return false
+	}
+	return s.AlertPhase != s.alertPhase() || d < s.AlertFired
+}
+
+// next time a threshold is reached in the running interval or break, zero when none is left
+func (s *State) NextAlertTime() time.Time {
+	_, times := s.alertTimes()
+	now := time.Now()
+	for _, at := range times {
+		if at.After(now) {
+			return at
+		}
+	}
+	return time.Time{}
+}
+
+// time left at the threshold, e.g. "5 minutes left"
+func alertMessage(d time.Duration) string {
+	switch {
+	case d == time.Minute:
+		return "1 minute left"
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%d minutes left", int(d.Minutes()))
+	case d == time.Second:
+		return "1 second left"
+	case d < time.Minute && d%time.Second == 0:
+		return fmt.Sprintf("%d seconds left", int(d.Seconds()))
+	}
+	return fmt.Sprintf("%v left", d.Round(time.Second))
+}
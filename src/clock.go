@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// wall clock layouts accepted for targets, matched against the lowercase value
+var clockFormats = []string{"15:04", "15:04:05", "3:04pm", "3:04 pm", "3pm", "3 pm"}
+
+// parse a wall clock time such as "12:00", "2:30pm" or "tomorrow 09:00"; a time that has already
+// passed today means the same time tomorrow
+func ParseClock(value string, now time.Time) (time.Time, error) {
+	clock := strings.ToLower(strings.TrimSpace(value))
+	rest, tomorrow := strings.CutPrefix(clock, "tomorrow")
+	clock = strings.TrimSpace(rest)
+	for _, format := range clockFormats {
+		parsed, err := time.ParseInLocation(format, clock, now.Location())
+		if err != nil {
+			continue
+		}
+		target := time.Date(now.Year(), now.Month(), now.Day(), parsed.Hour(), parsed.Minute(), parsed.Second(), 0, now.Location())
+		if tomorrow || !target.After(now) {
+			target = target.AddDate(0, 0, 1)
+		}
+		return target, nil
+	}
+	return time.Time{}, fmt.Errorf("'%v' invalid: use a duration or a time such as 14:30, 2:30pm or 'tomorrow 09:00'", value)
+}
+
+// flag value holding a duration, or the wall clock time a duration runs until
+type TimeValue struct {
+	Duration time.Duration
+	Until    time.Time
+}
+
+func (v *TimeValue) String() string {
+	if !v.Until.IsZero() {
+		return v.Until.Format(endTimeFormat)
+	}
+	return v.Duration.String()
+}
+
+func (v *TimeValue) Set(value string) error {
+	d, err := time.ParseDuration(value)
+	if err == nil {
+		v.Duration, v.Until = d, time.Time{}
+		return nil
+	}
+	until, err := ParseClock(value, time.Now())
+	if err != nil {
+		return err
+	}
+	v.Duration, v.Until = 0, until
+	return nil
+}
+
+func (v *TimeValue) IsSet() bool { return v.Duration > 0 || !v.Until.IsZero() }
+
+// value passed in a request, a duration or an RFC 3339 time
+func (v *TimeValue) Arg() string {
+	if !v.Until.IsZero() {
+		return v.Until.Format(time.RFC3339)
+	}
+	return v.Duration.String()
+}
+
+// interval length that ends at the Until time; pauses shorten it so the end does not move
+func (s *State) untilInterval() time.Duration {
+	start := time.Now()
+	if !s.TimerIsStopped() {
+		start = s.GetWorkStart()
+	}
+	d := s.Until.Sub(start) - s.PausedInterval
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// break length that ends at the BreakUntil time
+func (s *State) untilBreak() time.Duration {
+	end := time.Now().Add(s.GetInterval())
+	if !s.TimerIsStopped() {
+		end = s.GetWorkEnd()
+	}
+	d := s.BreakUntil.Sub(end) - s.PausedBreak + s.BreakOffset
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// wall clock targets apply to a single interval and break
+func (s *State) ClearUntil() {
+	s.Until = time.Time{}
+	s.BreakUntil = time.Time{}
+}
@@ -42,6 +42,33 @@ func (t *Task) SetDuration(s string) func(time.Duration) {
 	return nil
 }
 
+func (t *Task) SetDurations(s string) func([]time.Duration) {
+	cmd, ok := t.Durations[s]
+	if ok {
+		t.State.Debug.Print(t.State.Debug.Trace(), "SetDurations:", s)
+		return cmd
+	}
+	return nil
+}
+
+func (t *Task) SetUntil(s string) func(time.Time) {
+	cmd, ok := t.Until[s]
+	if ok {
+		t.State.Debug.Print(t.State.Debug.Trace(), "SetUntil:", s)
+		return cmd
+	}
+	return nil
+}
+
+func (t *Task) AdjustTime(s string) func(time.Duration) error {
+	cmd, ok := t.Adjust[s]
+	if ok {
+		t.State.Debug.Print(t.State.Debug.Trace(), "AdjustTime:", s)
+		return cmd
+	}
+	return nil
+}
+
 func (t *Task) SetString(s string) func(string) {
 	cmd, ok := t.Display[s]
 	if ok {
@@ -61,15 +88,33 @@ func (t *Task) LoadInputMaps() error {
 		"break":  t.Break,
 		"run":    t.RunInline,
 		"clear":  t.Clear,
+		"skip":   t.Skip,
+		"finish": t.Finish,
+		"reset":  t.Reset,
+		"lap":    t.Lap,
 	}
 	t.Duration = map[string]func(time.Duration){
-		"timer": t.State.SetInterval,
-		"break": t.State.SetBreak,
-		"alert": t.State.SetAlert,
+		"timer":     t.State.SetInterval,
+		"break":     t.State.SetBreak,
+		"longbreak": t.State.SetLongBreak,
+	}
+	t.Durations = map[string]func([]time.Duration){
+		"alert": t.State.SetAlerts,
+	}
+	t.Until = map[string]func(time.Time){
+		"timer": t.State.SetUntil,
+		"break": t.State.SetBreakUntil,
+	}
+	t.Adjust = map[string]func(time.Duration) error{
+		"extend":  t.Extend,
+		"shorten": t.Shorten,
+		"elapsed": t.AdjustElapsed,
+		"snooze":  t.Snooze,
 	}
 	t.Toggle = map[string]func(bool){
 		"restart":  t.Config.SetRestart,
 		"reverse":  t.Config.SetReverse,
+		"end":      t.Config.SetShowEnd,
 		"bell":     t.Config.SetBell,
 		"clock":    t.Config.SetHideTime,
 		"seconds":  t.Config.SetHideSeconds,
@@ -83,13 +128,20 @@ func (t *Task) LoadInputMaps() error {
 		"size":   t.Config.SetBarSize,
 		"style":  t.Config.SetBarStyle,
 		"symbol": t.Config.SetIcon,
+		"cycle":  t.State.SetCycle,
 	}
 	t.Status = map[string]func() string{
 		"info":   t.Info,
 		"status": t.GetState,
 	}
+	t.Details = map[string]func() any{
+		"info":   t.GetInfoDetails,
+		"status": t.GetStatusDetails,
+	}
 	t.Display = map[string]func(string){
-		"task": t.State.SetTask,
+		"task":     t.State.SetTask,
+		"iconset":  t.Config.SetIconName,
+		"barstyle": t.Config.SetBarName,
 	}
 	return nil
 }
@@ -2,8 +2,10 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 )
 
 // initialize and/or load config data structure
@@ -25,28 +27,43 @@ func InitializeConfig() (*Config, error) {
 }
 
 type Config struct {
-	BarSize     int      `json:"barsize"`
-	BarStyle    int      `json:"barstyle"`
-	Icon        int      `json:"icon"`
-	TaskLength  int      `json:"tasklength"`
-	Restart     bool     `json:"restart"`
-	Bell        bool     `json:"bell"`
-	HideTime    bool     `json:"hidetime"`
-	HideTask    bool     `json:"hidetask"`
-	HideSeconds bool     `json:"hideseconds"`
-	HideIcon    bool     `json:"hideicon"`
-	HideBar     bool     `json:"hidebar"`
-	ReverseTime bool     `json:"reverse"`
-	Percent     bool     `json:"percent"`
-	Notify      bool     `json:"notify"`
-	NotifyTmux  bool     `json:"tmux"`
-	Log         bool     `json:"log"`
-	Debug       *History `json:"-"`
+	BarSize     int                          `json:"barsize"`
+	BarStyle    int                          `json:"barstyle"`
+	Icon        int                          `json:"icon"`
+	TaskLength  int                          `json:"tasklength"`
+	Restart     bool                         `json:"restart"`
+	Bell        bool                         `json:"bell"`
+	HideTime    bool                         `json:"hidetime"`
+	HideTask    bool                         `json:"hidetask"`
+	HideSeconds bool                         `json:"hideseconds"`
+	HideIcon    bool                         `json:"hideicon"`
+	HideBar     bool                         `json:"hidebar"`
+	ReverseTime bool                         `json:"reverse"`
+	Percent     bool                         `json:"percent"`
+	ShowEnd     bool                         `json:"showend"`          // display the projected end time
+	Notify      bool                         `json:"notify,omitempty"` // replaced by notifiers, read from older configs
+	NotifyTmux  bool                         `json:"tmux,omitempty"`   // replaced by notifiers, read from older configs
+	Notifiers   []NotifierConfig             `json:"notifiers,omitempty"`
+	Messages    map[string]MessageConfig     `json:"messages,omitempty"` // notification text per event
+	Log         bool                         `json:"log"`
+	Format      string                       `json:"format,omitempty"`    // status line template, empty uses the default layout
+	Theme       string                       `json:"theme,omitempty"`     // color theme name, empty disables color
+	ColorMode   string                       `json:"colormode,omitempty"` // auto, ansi, tmux or none
+	Themes      map[string]Theme             `json:"themes,omitempty"`
+	IconName    string                       `json:"iconname,omitempty"` // selected icon set by name, takes priority over icon
+	BarName     string                       `json:"barname,omitempty"`  // selected bar style by name, takes priority over barstyle
+	IconSets    map[string]map[string]string `json:"iconsets,omitempty"`
+	BarStyles   map[string]map[string]string `json:"barstyles,omitempty"`
+	Routines    map[string][]Phase           `json:"routines,omitempty"`
+	Hooks       map[string][]string          `json:"hooks,omitempty"`       // commands run in order on each timer event
+	HookTimeout int                          `json:"hooktimeout,omitempty"` // seconds a hook may run, 0 uses the default
+	Debug       *History                     `json:"-"`
 }
 
 func (c *Config) SetRestart(state bool)     { c.Restart = state }
 func (c *Config) SetBell(state bool)        { c.Bell = state }
 func (c *Config) SetPercent(state bool)     { c.Percent = state }
+func (c *Config) SetShowEnd(state bool)     { c.ShowEnd = state }
 func (c *Config) SetReverse(state bool)     { c.ReverseTime = state }
 func (c *Config) SetHideTime(state bool)    { c.HideTime = state }
 func (c *Config) SetHideTask(state bool)    { c.HideTask = state }
@@ -54,10 +71,103 @@ func (c *Config) SetHideSeconds(state bool) { c.HideSeconds = state }
 func (c *Config) SetHideBar(state bool)     { c.HideBar = state }
 func (c *Config) SetHideIcon(state bool)    { c.HideIcon = state }
 func (c *Config) SetBarSize(v int)          { c.BarSize = v }
-func (c *Config) SetBarStyle(v int)         { c.BarStyle = v }
-func (c *Config) SetIcon(v int)             { c.Icon = v }
-func (c *Config) SetNotify(state bool)      { c.Notify = state }
-func (c *Config) SetNotifyTmux(state bool)  { c.NotifyTmux = state }
+func (c *Config) SetBarStyle(v int)         { c.BarStyle = v; c.BarName = "" }
+func (c *Config) SetIcon(v int)             { c.Icon = v; c.IconName = "" }
+func (c *Config) SetIconName(v string)      { c.IconName = v }
+func (c *Config) SetBarName(v string)       { c.BarName = v }
+func (c *Config) SetNotify(state bool)      { c.SetNotifier(notifierSend, state) }
+func (c *Config) SetNotifyTmux(state bool)  { c.SetNotifier(notifierTmuxPopup, state) }
+
+// returns if a notifier of the type is in the notifiers list
+func (c *Config) NotifierEnabled(kind string) bool {
+	for _, n := range c.Notifiers {
+		if n.Type == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// add a notifier of the type with default options, or remove every notifier of the type
+func (c *Config) SetNotifier(kind string, state bool) {
+	if state {
+		if !c.NotifierEnabled(kind) {
+			c.Notifiers = append(c.Notifiers, NotifierConfig{Type: kind})
+		}
+		return
+	}
+	var notifiers []NotifierConfig
+	for _, n := range c.Notifiers {
+		if n.Type != kind {
+			notifiers = append(notifiers, n)
+		}
+	}
+	c.Notifiers = notifiers
+}
+
+// types of the enabled notifiers
+func (c *Config) NotifierTypes() []string {
+	types := []string{} // listed as [] in json when none are enabled
+	for _, n := range c.Notifiers {
+		types = append(types, n.Type)
+	}
+	return types
+}
+
+// move the notify and tmux toggles of older configs to the notifiers list
+func (c *Config) MigrateNotify() {
+	if c.Notify {
+		c.SetNotifier(notifierSend, true)
+	}
+	if c.NotifyTmux {
+		c.SetNotifier(notifierTmuxPopup, true)
+	}
+	c.Notify = false
+	c.NotifyTmux = false
+}
+
+// look up an icon set by name, custom sets take priority over built-in sets
+func (c *Config) GetIconSet(name string) (map[string]string, bool) {
+	set, ok := c.IconSets[name]
+	if !ok {
+		set, ok = iconSets[name]
+	}
+	return set, ok
+}
+
+// look up a bar style by name, custom styles take priority over built-in styles
+func (c *Config) GetBarStyle(name string) (map[string]string, bool) {
+	style, ok := c.BarStyles[name]
+	if !ok {
+		style, ok = barStyles[name]
+	}
+	return style, ok
+}
+
+// sorted names of built-in and custom icon sets
+func (c *Config) IconSetNames() []string {
+	return setNames(iconSets, c.IconSets)
+}
+
+// sorted names of built-in and custom bar styles
+func (c *Config) BarStyleNames() []string {
+	return setNames(barStyles, c.BarStyles)
+}
+
+func setNames(sets ...map[string]map[string]string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, set := range sets {
+		for name := range set {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
 
 // convert bytes (from file) to configuration struct
 func (c *Config) Unmarshal(bytes []byte) error {
@@ -77,6 +187,19 @@ func (c Config) Marshal() ([]byte, error) {
 	return json, nil
 }
 
+// path of the configuration file in the user config directory, or next to the binary
+func ConfigPath() (string, error) {
+	path, err := os.UserConfigDir()
+	if err != nil {
+		path, err = os.Executable()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Dir(path)
+	}
+	return filepath.Join(path, programName, ConfigFile), nil
+}
+
 // save configuration to file using config standard path, create if necessary
 func (c *Config) Save() error {
 	bytes, err := c.Marshal()
@@ -84,16 +207,11 @@ func (c *Config) Save() error {
 		return err
 	}
 
-	path, err := os.UserConfigDir()
+	configuration, err := ConfigPath()
 	if err != nil {
-		c.Debug.Print("UserConfigDir() failed, using binary path", err)
-		path, err = os.Executable()
-		if err != nil {
-			return err
-		}
+		c.Debug.Print("ConfigPath() failed", err)
+		return err
 	}
-	
-	configuration := filepath.Join(path, programName, ConfigFile)	
 	_, err = checkFilePath(filepath.Dir(configuration)) // make sure directory is present
 	if err != nil {
 		err = createDirectory(filepath.Dir(configuration))
@@ -111,28 +229,22 @@ func (c *Config) Save() error {
 
 // load configuration from file, use default configuration on io error
 func (c *Config) Load() error {
-	var path, loadFile string
-
-	path, err := os.UserConfigDir()
+	loadFile, err := ConfigPath()
 	if err != nil {
-		c.Debug.Print("UserConfigDir() failed, using binary path", err)
-		path, err = os.Executable()
-		if err != nil {
-			c.Debug.Print("os.Executable() failed to get binary path", err)
-			return err
-		}
-		path = filepath.Dir(path)
+		c.Debug.Print("ConfigPath() failed", err)
+		return err
 	}
-
-	loadFile = filepath.Join(path, programName, ConfigFile)
 	bytes, err := readFile(loadFile)
 	if err != nil {
 		return err
 	}
 	err = c.Unmarshal(bytes)
 	if err != nil {
+		// the config is edited by hand, report it but leave the file in place
+		fmt.Fprintf(os.Stderr, "%v: %v is invalid, using defaults: %v\n", programName, loadFile, err)
 		return err
 	}
+	c.MigrateNotify()
 	return nil
 }
 
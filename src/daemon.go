@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	SocketFile   = "terminalTimer.sock" // daemon control socket
+	daemonTick   = 1 * time.Second      // rate the daemon updates every timer when changes can not be watched
+	daemonIdle   = 1 * time.Minute      // longest wait between updates when watching for changes
+	dialTimeout  = 500 * time.Millisecond
+	replyTimeout = 5 * time.Second
+)
+
+var errNoDaemon = errors.New("daemon not running")
+
+// command sent to the daemon, one json object per connection
+type Request struct {
+	Command string   `json:"command"`
+	Name    string   `json:"name"` // timer name, empty for the default timer
+	Args    []string `json:"args,omitempty"`
+}
+
+type Response struct {
+	Output string `json:"output"`
+	Error  string `json:"error,omitempty"`
+}
+
+// socket path in the user runtime directory, or next to the state files
+func SocketPath() (string, error) {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, SocketFile), nil
+	}
+	dir, err := StateDirectory()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, SocketFile), nil
+}
+
+// send the request to a running daemon, or execute it directly when no daemon is listening
+func Dispatch(r Request) (string, error) {
+	output, err := r.Send()
+	if errors.Is(err, errNoDaemon) {
+		return r.Execute()
+	}
+	return output, err
+}
+
+// send the request over the daemon socket and wait for the response
+func (r Request) Send() (string, error) {
+	path, err := SocketPath()
+	if err != nil {
+		return "", errNoDaemon
+	}
+	conn, err := net.DialTimeout("unix", path, dialTimeout)
+	if err != nil {
+		return "", errNoDaemon
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(replyTimeout))
+
+	err = json.NewEncoder(conn).Encode(r)
+	if err != nil {
+		return "", err
+	}
+	var response Response
+	err = json.NewDecoder(bufio.NewReader(conn)).Decode(&response)
+	if err != nil {
+		return "", err
+	}
+	if response.Error != "" {
+		return response.Output, errors.New(response.Error)
+	}
+	return response.Output, nil
+}
+
+// commands that start a timer under a name that has no state yet, the others need an existing timer
+var createsTimer = map[string]bool{
+	"start":     true,
+	"set":       true,
+	"task":      true,
+	"routine":   true,
+	"stopwatch": true,
+	"run":       true,
+}
+
+// run the request against the timer state on disk
+func (r Request) Execute() (string, error) {
+	if r.Name != "" && !ValidTimerName(r.Name) {
+		return "", fmt.Errorf("invalid timer name: %v", r.Name)
+	}
+	if !TimerExists(r.Name) && !createsTimer[r.Command] {
+		return "", fmt.Errorf("no such timer: %v", r.Name)
+	}
+	t, _ := InitializeNamedTimer(r.Name)
+	if _, ok := t.Status[r.Command]; ok {
+		t.GetTime() // fire the ends that passed, so the answer shows the phase that follows them
+		return t.StatusString(r.Command, r.Args)
+	}
+	return "", t.Update(func() error {
+		switch r.Command {
+		case "run":
+			return errors.New("run can not be sent to the daemon")
+		case "task":
+			cmd := t.SetString("task")
+			cmd(strings.Join(r.Args, " "))
+			t.Message("changed task to")
+			t.QueueHook(hookTaskChange)
+			return t.State.Save()
+		case "routine":
+			return t.StartRoutine(strings.Join(r.Args, " "))
+		case "set":
+			return t.SetValues(r.Args)
+		case "stopwatch":
+			var target time.Duration
+			if len(r.Args) > 0 {
+				var err error
+				target, err = time.ParseDuration(r.Args[0])
+				if err != nil {
+					return err
+				}
+			}
+			return t.StartStopwatch(target)
+		case "start":
+			err := t.Start()
+			if err != nil || len(r.Args) == 0 {
+				return err
+			}
+			return t.SetValues(r.Args) // wall clock target of the new interval
+		}
+		if cmd := t.AdjustTime(r.Command); cmd != nil {
+			d, err := time.ParseDuration(strings.Join(r.Args, ""))
+			if err != nil {
+				return err
+			}
+			return cmd(d)
+		}
+		cmd := t.ExecuteCommand(r.Command)
+		if cmd == nil {
+			return fmt.Errorf("invalid command: %v", r.Command)
+		}
+		return cmd()
+	})
+}
+
+// apply key=value pairs from the set command, e.g. timer=25m0s, timer=2026-01-02T12:00:00+01:00,
+// alert=5m0s,1m0s or cycle=4
+func (t *Task) SetValues(values []string) error {
+	for _, value := range values {
+		key, arg, ok := strings.Cut(value, "=")
+		if !ok {
+			return fmt.Errorf("invalid value: %v", value)
+		}
+		if cmd := t.SetUntil(key); cmd != nil {
+			until, err := time.Parse(time.RFC3339, arg)
+			if err == nil {
+				cmd(until)
+				continue
+			}
+		}
+		if cmd := t.SetDurations(key); cmd != nil {
+			thresholds, err := ParseAlerts(arg)
+			if err != nil {
+				return err
+			}
+			cmd(thresholds)
+			continue
+		}
+		if cmd := t.SetDuration(key); cmd != nil {
+			d, err := time.ParseDuration(arg)
+			if err != nil {
+				return err
+			}
+			cmd(d)
+			continue
+		}
+		if cmd := t.SetOption(key); cmd != nil {
+			n, err := strconv.Atoi(arg)
+			if err != nil {
+				return err
+			}
+			cmd(n)
+			continue
+		}
+		return fmt.Errorf("invalid value: %v", value)
+	}
+	return t.State.Save()
+}
+
+// background process owning the timer state: updates every timer on time and serves commands
+type Daemon struct {
+	listener net.Listener
+	path     string
+	mutex    sync.Mutex // one command or update at a time
+	debug    *History
+}
+
+func RunDaemon() error {
+	var d Daemon
+	var err error
+	d.debug, err = InitializeDebugLog()
+	if err != nil {
+		d.debug.Enable(false)
+	}
+	d.path, err = SocketPath()
+	if err != nil {
+		return err
+	}
+	_, err = (Request{Command: "ping"}).Send()
+	if !errors.Is(err, errNoDaemon) {
+		return fmt.Errorf("daemon already listening on %v", d.path)
+	}
+	os.Remove(d.path) // stale socket of a daemon that did not exit cleanly
+	_, err = checkFilePath(filepath.Dir(d.path))
+	if err != nil {
+		err = createDirectory(filepath.Dir(d.path))
+		if err != nil {
+			return err
+		}
+	}
+	d.listener, err = net.Listen("unix", d.path)
+	if err != nil {
+		return err
+	}
+	os.Chmod(d.path, 0600)
+	defer d.Close()
+
+	quitting := make(chan os.Signal, 1)
+	signal.Notify(quitting, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-quitting
+		d.Close()
+		os.Exit(0)
+	}()
+
+	StartHookWorker()
+	EnableNotificationActions()
+	go d.Update()
+	d.debug.Print("daemon listening on", d.path)
+	for {
+		conn, err := d.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			d.debug.Print("daemon accept:", err)
+			continue
+		}
+		go d.Serve(conn)
+	}
+}
+
+func (d *Daemon) Close() {
+	d.listener.Close()
+	os.Remove(d.path)
+}
+
+// fire notifications, restarts and routine phases of every timer, even when nothing renders; sleep
+// until the next interval or break ends or a file changes, or poll when changes can not be watched
+func (d *Daemon) Update() {
+	changed, err := WatchFiles(WatchDirectories()...)
+	if err != nil {
+		d.debug.Print("daemon polling for changes:", err)
+	}
+	for {
+		next := d.UpdateTimers()
+		wait := daemonTick
+		if changed != nil {
+			wait = daemonIdle
+			if !next.IsZero() && time.Until(next) < wait {
+				wait = time.Until(next) + 10*time.Millisecond // wake just after the end
+			}
+		}
+		select {
+		case <-changed:
+		case <-time.After(wait):
+		}
+	}
+}
+
+// update every timer, returns the earliest time one of them is due next
+func (d *Daemon) UpdateTimers() time.Time {
+	var next time.Time
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	names, err := TimerNames()
+	if err != nil {
+		d.debug.Print("daemon update:", err)
+	}
+	for _, name := range names {
+		t, _ := InitializeNamedTimer(name)
+		t.GetTime()
+		fmt.Print(t.RingBell()) // reaches the terminal the daemon was started from
+		due := t.State.NextEventTime()
+		if !due.IsZero() && (next.IsZero() || due.Before(next)) {
+			next = due
+		}
+	}
+	return next
+}
+
+// handle a single request and reply
+func (d *Daemon) Serve(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(replyTimeout))
+	var r Request
+	var response Response
+	err := json.NewDecoder(bufio.NewReader(conn)).Decode(&r)
+	if err != nil {
+		d.debug.Print("daemon request:", err)
+		return
+	}
+	if r.Command == "ping" {
+		json.NewEncoder(conn).Encode(response)
+		return
+	}
+	if r.Command == "shutdown" {
+		json.NewEncoder(conn).Encode(response)
+		d.Close()
+		os.Exit(0)
+	}
+	d.mutex.Lock()
+	response.Output, err = r.Execute()
+	d.mutex.Unlock()
+	if err != nil {
+		response.Error = err.Error()
+	}
+	json.NewEncoder(conn).Encode(response)
+}
@@ -0,0 +1,726 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minimal client of the D-Bus wire protocol, enough to call methods with basic arguments on the
+// session bus and receive signals
+
+const (
+	dbusMethodCall   = 1
+	dbusMethodReturn = 2
+	dbusError        = 3
+	dbusSignal       = 4
+
+	dbusCallTimeout = 5 * time.Second
+	dbusMaxMessage  = 1 << 27
+)
+
+// header field codes
+const (
+	dbusFieldPath        = 1
+	dbusFieldInterface   = 2
+	dbusFieldMember      = 3
+	dbusFieldErrorName   = 4
+	dbusFieldReplySerial = 5
+	dbusFieldDestination = 6
+	dbusFieldSender      = 7
+	dbusFieldSignature   = 8
+)
+
+var errBusClosed = errors.New("dbus connection closed")
+
+type DBusMessage struct {
+	Type        byte
+	Flags       byte
+	Serial      uint32
+	ReplySerial uint32
+	Path        string
+	Interface   string
+	Member      string
+	ErrorName   string
+	Destination string
+	Sender      string
+	Signature   string
+	Body        []any // decoded arrays, structs and dict entries are []any
+}
+
+// value of a variant argument along with its signature, e.g. {"y", byte(1)}
+type DBusVariant struct {
+	Signature string
+	Value     any
+}
+
+type DBusConn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	mutex   sync.Mutex // guards writes, serial and pending
+	serial  uint32
+	pending map[uint32]chan *DBusMessage
+	closed  bool
+	Signals chan *DBusMessage // signals matched with AddMatch, dropped when nobody reads them
+	Name    string            // unique name assigned by the bus
+}
+
+// path of the session bus socket from DBUS_SESSION_BUS_ADDRESS, or the default in XDG_RUNTIME_DIR
+func SessionBusAddress() (string, error) {
+	address := os.Getenv("DBUS_SESSION_BUS_ADDRESS")
+	if address == "" {
+		runtime := os.Getenv("XDG_RUNTIME_DIR")
+		if runtime == "" {
+			return "", errors.New("no session bus: DBUS_SESSION_BUS_ADDRESS is not set")
+		}
+		address = "unix:path=" + runtime + "/bus"
+	}
+	for _, entry := range strings.Split(address, ";") {
+		transport, params, _ := strings.Cut(entry, ":")
+		if transport != "unix" {
+			continue
+		}
+		for _, param := range strings.Split(params, ",") {
+			key, value, _ := strings.Cut(param, "=")
+			switch key {
+			case "path":
+				return value, nil
+			case "abstract":
+				return "@" + value, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no supported transport in bus address %v", address)
+}
+
+// connect and authenticate to the session bus
+func DialSessionBus() (*DBusConn, error) {
+	path, err := SessionBusAddress()
+	if err != nil {
+		return nil, err
+	}
+	return DialBus(path)
+}
+
+// connect to the bus listening on a unix socket, authenticate with the user id and say hello
+func DialBus(path string) (*DBusConn, error) {
+	conn, err := net.DialTimeout("unix", path, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &DBusConn{
+		conn:    conn,
+		reader:  bufio.NewReader(conn),
+		pending: map[uint32]chan *DBusMessage{},
+		Signals: make(chan *DBusMessage, 16),
+	}
+	conn.SetDeadline(time.Now().Add(dbusCallTimeout))
+	err = c.auth()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	go c.read()
+	reply, err := c.Call("org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "Hello", "")
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	c.Name, _ = reply.StringArg(0)
+	return c, nil
+}
+
+// EXTERNAL authentication, the bus checks the uid of the socket peer
+func (c *DBusConn) auth() error {
+	uid := hex.EncodeToString([]byte(strconv.Itoa(os.Getuid())))
+	_, err := fmt.Fprintf(c.conn, "\x00AUTH EXTERNAL %v\r\n", uid)
+	if err != nil {
+		return err
+	}
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "OK ") {
+		return fmt.Errorf("dbus authentication rejected: %v", strings.TrimSpace(line))
+	}
+	_, err = fmt.Fprintf(c.conn, "BEGIN\r\n")
+	return err
+}
+
+func (c *DBusConn) Close() error {
+	c.mutex.Lock()
+	c.closed = true
+	c.mutex.Unlock()
+	return c.conn.Close()
+}
+
+// true once the connection failed or was closed
+func (c *DBusConn) Closed() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.closed
+}
+
+// call a method and wait for its reply; an error reply is returned as an error
+func (c *DBusConn) Call(destination, path, iface, member, signature string, args ...any) (*DBusMessage, error) {
+	m := &DBusMessage{
+		Type:        dbusMethodCall,
+		Path:        path,
+		Interface:   iface,
+		Member:      member,
+		Destination: destination,
+		Signature:   signature,
+		Body:        args,
+	}
+	reply := make(chan *DBusMessage, 1)
+	err := c.send(m, reply)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case r, ok := <-reply:
+		if !ok {
+			return nil, errBusClosed
+		}
+		if r.Type == dbusError {
+			text, _ := r.StringArg(0)
+			return nil, fmt.Errorf("%v: %v", r.ErrorName, text)
+		}
+		return r, nil
+	case <-time.After(dbusCallTimeout):
+		c.mutex.Lock()
+		delete(c.pending, m.Serial)
+		c.mutex.Unlock()
+		return nil, fmt.Errorf("dbus %v: no reply", member)
+	}
+}
+
+// ask the bus to route matching signals to this connection, e.g. "type='signal',member='X'"
+func (c *DBusConn) AddMatch(rule string) error {
+	_, err := c.Call("org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "AddMatch", "s", rule)
+	return err
+}
+
+func (c *DBusConn) send(m *DBusMessage, reply chan *DBusMessage) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return errBusClosed
+	}
+	c.serial++
+	m.Serial = c.serial
+	bytes, err := m.Marshal()
+	if err != nil {
+		return err
+	}
+	if reply != nil {
+		c.pending[m.Serial] = reply
+	}
+	_, err = c.conn.Write(bytes)
+	if err != nil {
+		delete(c.pending, m.Serial)
+	}
+	return err
+}
+
+// hand replies to their callers and signals to the Signals channel until the connection fails
+func (c *DBusConn) read() {
+	for {
+		m, err := ReadDBusMessage(c.reader)
+		if err != nil {
+			c.mutex.Lock()
+			c.closed = true
+			for serial, reply := range c.pending {
+				close(reply)
+				delete(c.pending, serial)
+			}
+			c.mutex.Unlock()
+			close(c.Signals)
+			return
+		}
+		switch m.Type {
+		case dbusMethodReturn, dbusError:
+			c.mutex.Lock()
+			reply, ok := c.pending[m.ReplySerial]
+			delete(c.pending, m.ReplySerial)
+			c.mutex.Unlock()
+			if ok {
+				reply <- m
+			}
+		case dbusSignal:
+			select {
+			case c.Signals <- m:
+			default:
+			}
+		}
+	}
+}
+
+// string argument n of the body
+func (m *DBusMessage) StringArg(n int) (string, bool) {
+	if n >= len(m.Body) {
+		return "", false
+	}
+	v, ok := m.Body[n].(string)
+	return v, ok
+}
+
+// uint32 argument n of the body
+func (m *DBusMessage) Uint32Arg(n int) (uint32, bool) {
+	if n >= len(m.Body) {
+		return 0, false
+	}
+	v, ok := m.Body[n].(uint32)
+	return v, ok
+}
+
+// encode the message in little endian byte order
+func (m *DBusMessage) Marshal() ([]byte, error) {
+	var body dbusEncoder
+	types, err := splitSignature(m.Signature)
+	if err != nil {
+		return nil, err
+	}
+	if len(types) != len(m.Body) {
+		return nil, fmt.Errorf("dbus signature %v does not match %d arguments", m.Signature, len(m.Body))
+	}
+	for k, t := range types {
+		err = body.value(t, m.Body[k])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var e dbusEncoder
+	e.bytes('l', m.Type, m.Flags, 1)
+	e.uint32(uint32(len(body.buf)))
+	e.uint32(m.Serial)
+	e.array(8, func() {
+		field := func(code byte, signature string, value any) {
+			e.align(8)
+			e.bytes(code)
+			e.signature(signature)
+			e.value(signature, value)
+		}
+		if m.Path != "" {
+			field(dbusFieldPath, "o", m.Path)
+		}
+		if m.Interface != "" {
+			field(dbusFieldInterface, "s", m.Interface)
+		}
+		if m.Member != "" {
+			field(dbusFieldMember, "s", m.Member)
+		}
+		if m.ErrorName != "" {
+			field(dbusFieldErrorName, "s", m.ErrorName)
+		}
+		if m.ReplySerial != 0 {
+			field(dbusFieldReplySerial, "u", m.ReplySerial)
+		}
+		if m.Destination != "" {
+			field(dbusFieldDestination, "s", m.Destination)
+		}
+		if m.Signature != "" {
+			field(dbusFieldSignature, "g", m.Signature)
+		}
+	})
+	e.align(8)
+	return append(e.buf, body.buf...), nil
+}
+
+// read and decode one message
+func ReadDBusMessage(r io.Reader) (*DBusMessage, error) {
+	fixed := make([]byte, 16)
+	_, err := io.ReadFull(r, fixed)
+	if err != nil {
+		return nil, err
+	}
+	var order binary.ByteOrder
+	switch fixed[0] {
+	case 'l':
+		order = binary.LittleEndian
+	case 'B':
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("dbus message with invalid byte order %q", fixed[0])
+	}
+	bodyLength := order.Uint32(fixed[4:])
+	fieldsLength := order.Uint32(fixed[12:])
+	headerLength := 16 + int(fieldsLength)
+	padded := (headerLength + 7) &^ 7
+	if int(bodyLength)+padded > dbusMaxMessage {
+		return nil, errors.New("dbus message too long")
+	}
+	buf := make([]byte, padded+int(bodyLength))
+	copy(buf, fixed)
+	_, err = io.ReadFull(r, buf[16:])
+	if err != nil {
+		return nil, err
+	}
+
+	m := &DBusMessage{Type: fixed[1], Flags: fixed[2], Serial: order.Uint32(fixed[8:])}
+	d := dbusDecoder{buf: buf[:headerLength], pos: 16, order: order}
+	for d.pos < headerLength {
+		d.align(8)
+		code, err := d.byte()
+		if err != nil {
+			return nil, err
+		}
+		field, err := d.value("v")
+		if err != nil {
+			return nil, err
+		}
+		value := field.(DBusVariant).Value
+		switch code {
+		case dbusFieldPath:
+			m.Path, _ = value.(string)
+		case dbusFieldInterface:
+			m.Interface, _ = value.(string)
+		case dbusFieldMember:
+			m.Member, _ = value.(string)
+		case dbusFieldErrorName:
+			m.ErrorName, _ = value.(string)
+		case dbusFieldReplySerial:
+			m.ReplySerial, _ = value.(uint32)
+		case dbusFieldDestination:
+			m.Destination, _ = value.(string)
+		case dbusFieldSender:
+			m.Sender, _ = value.(string)
+		case dbusFieldSignature:
+			m.Signature, _ = value.(string)
+		}
+	}
+
+	types, err := splitSignature(m.Signature)
+	if err != nil {
+		return nil, err
+	}
+	d = dbusDecoder{buf: buf[padded:], order: order}
+	for _, t := range types {
+		v, err := d.value(t)
+		if err != nil {
+			return nil, err
+		}
+		m.Body = append(m.Body, v)
+	}
+	return m, nil
+}
+
+// split a signature into its complete types, e.g. "sa{sv}i" into "s", "a{sv}" and "i"
+func splitSignature(signature string) ([]string, error) {
+	var types []string
+	for len(signature) > 0 {
+		n, err := nextType(signature)
+		if err != nil {
+			return nil, err
+		}
+		types = append(types, signature[:n])
+		signature = signature[n:]
+	}
+	return types, nil
+}
+
+// length of the first complete type of a signature
+func nextType(signature string) (int, error) {
+	if signature == "" {
+		return 0, errors.New("dbus signature ends early")
+	}
+	switch signature[0] {
+	case 'a':
+		n, err := nextType(signature[1:])
+		return n + 1, err
+	case '(', '{':
+		end := byte(')')
+		if signature[0] == '{' {
+			end = '}'
+		}
+		n := 1
+		for n < len(signature) && signature[n] != end {
+			m, err := nextType(signature[n:])
+			if err != nil {
+				return 0, err
+			}
+			n += m
+		}
+		if n >= len(signature) {
+			return 0, fmt.Errorf("dbus signature %v is not closed", signature)
+		}
+		return n + 1, nil
+	case 'y', 'b', 'n', 'q', 'i', 'u', 'x', 't', 'd', 's', 'o', 'g', 'v', 'h':
+		return 1, nil
+	}
+	return 0, fmt.Errorf("dbus type %q is not supported", signature[0])
+}
+
+// alignment of the first type of a signature
+func typeAlignment(signature string) int {
+	switch signature[0] {
+	case 'y', 'g', 'v':
+		return 1
+	case 'n', 'q':
+		return 2
+	case 'x', 't', 'd', '(', '{':
+		return 8
+	}
+	return 4
+}
+
+type dbusEncoder struct{ buf []byte }
+
+func (e *dbusEncoder) align(n int) {
+	for len(e.buf)%n != 0 {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *dbusEncoder) bytes(v ...byte) { e.buf = append(e.buf, v...) }
+
+func (e *dbusEncoder) uint32(v uint32) {
+	e.align(4)
+	e.buf = binary.LittleEndian.AppendUint32(e.buf, v)
+}
+
+func (e *dbusEncoder) string(v string) {
+	e.uint32(uint32(len(v)))
+	e.buf = append(append(e.buf, v...), 0)
+}
+
+func (e *dbusEncoder) signature(v string) {
+	e.buf = append(append(append(e.buf, byte(len(v))), v...), 0)
+}
+
+// array length followed by its elements, the length leaves out the padding before the first one
+func (e *dbusEncoder) array(alignment int, elements func()) {
+	e.uint32(0)
+	at := len(e.buf) - 4
+	e.align(alignment)
+	start := len(e.buf)
+	elements()
+	binary.LittleEndian.PutUint32(e.buf[at:], uint32(len(e.buf)-start))
+}
+
+// encode a value of the given complete type; arrays take []any, []string or, for a{sv},
+// map[string]DBusVariant
+func (e *dbusEncoder) value(signature string, v any) error {
+	var ok bool
+	switch signature[0] {
+	case 'y':
+		var b byte
+		b, ok = v.(byte)
+		e.bytes(b)
+	case 'b':
+		var b bool
+		b, ok = v.(bool)
+		n := uint32(0)
+		if b {
+			n = 1
+		}
+		e.uint32(n)
+	case 'u':
+		var n uint32
+		n, ok = v.(uint32)
+		e.uint32(n)
+	case 'i':
+		var n int32
+		n, ok = v.(int32)
+		e.uint32(uint32(n))
+	case 's', 'o':
+		var s string
+		s, ok = v.(string)
+		e.string(s)
+	case 'g':
+		var s string
+		s, ok = v.(string)
+		e.signature(s)
+	case 'v':
+		var variant DBusVariant
+		variant, ok = v.(DBusVariant)
+		if ok {
+			e.signature(variant.Signature)
+			return e.value(variant.Signature, variant.Value)
+		}
+	case 'a':
+		return e.arrayValue(signature[1:], v)
+	}
+	if !ok {
+		return fmt.Errorf("dbus value %v does not match type %v", v, signature)
+	}
+	return nil
+}
+
+func (e *dbusEncoder) arrayValue(element string, v any) error {
+	var err error
+	switch values := v.(type) {
+	case []string:
+		e.array(typeAlignment(element), func() {
+			for _, s := range values {
+				if err == nil {
+					err = e.value(element, s)
+				}
+			}
+		})
+	case []any:
+		e.array(typeAlignment(element), func() {
+			for _, value := range values {
+				if err == nil {
+					err = e.value(element, value)
+				}
+			}
+		})
+	case map[string]DBusVariant:
+		if element != "{sv}" {
+			return fmt.Errorf("dbus dict of type a%v is not supported", element)
+		}
+		e.array(8, func() {
+			for key, value := range values {
+				e.align(8)
+				e.string(key)
+				if err == nil {
+					err = e.value("v", value)
+				}
+			}
+		})
+	default:
+		return fmt.Errorf("dbus value %v does not match type a%v", v, element)
+	}
+	return err
+}
+
+type dbusDecoder struct {
+	buf   []byte
+	pos   int
+	order binary.ByteOrder
+}
+
+func (d *dbusDecoder) align(n int) {
+	d.pos = (d.pos + n - 1) / n * n
+}
+
+func (d *dbusDecoder) take(n int) ([]byte, error) {
+	if d.pos+n > len(d.buf) {
+		return nil, errors.New("dbus message ends early")
+	}
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *dbusDecoder) byte() (byte, error) {
+	b, err := d.take(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (d *dbusDecoder) fixed(size int) ([]byte, error) {
+	d.align(size)
+	return d.take(size)
+}
+
+// decode a value of the given complete type
+func (d *dbusDecoder) value(signature string) (any, error) {
+	switch signature[0] {
+	case 'y':
+		return d.byte()
+	case 'b', 'u', 'i', 'h':
+		b, err := d.fixed(4)
+		if err != nil {
+			return nil, err
+		}
+		n := d.order.Uint32(b)
+		switch signature[0] {
+		case 'b':
+			return n != 0, nil
+		case 'i':
+			return int32(n), nil
+		}
+		return n, nil
+	case 'n', 'q':
+		b, err := d.fixed(2)
+		if err != nil {
+			return nil, err
+		}
+		return d.order.Uint16(b), nil
+	case 'x', 't', 'd':
+		b, err := d.fixed(8)
+		if err != nil {
+			return nil, err
+		}
+		return d.order.Uint64(b), nil
+	case 's', 'o':
+		b, err := d.fixed(4)
+		if err != nil {
+			return nil, err
+		}
+		s, err := d.take(int(d.order.Uint32(b)) + 1)
+		if err != nil {
+			return nil, err
+		}
+		return string(s[:len(s)-1]), nil
+	case 'g':
+		n, err := d.byte()
+		if err != nil {
+			return nil, err
+		}
+		s, err := d.take(int(n) + 1)
+		if err != nil {
+			return nil, err
+		}
+		return string(s[:len(s)-1]), nil
+	case 'v':
+		sig, err := d.value("g")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := nextType(sig.(string)); err != nil {
+			return nil, err
+		}
+		v, err := d.value(sig.(string))
+		return DBusVariant{Signature: sig.(string), Value: v}, err
+	case 'a':
+		b, err := d.fixed(4)
+		if err != nil {
+			return nil, err
+		}
+		element := signature[1:]
+		d.align(typeAlignment(element))
+		end := d.pos + int(d.order.Uint32(b))
+		var values []any
+		for d.pos < end {
+			v, err := d.value(element)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	case '(', '{':
+		d.align(8)
+		types, err := splitSignature(signature[1 : len(signature)-1])
+		if err != nil {
+			return nil, err
+		}
+		var values []any
+		for _, t := range types {
+			v, err := d.value(t)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("dbus type %v is not supported", signature)
+}
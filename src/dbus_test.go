@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSplitSignature(t *testing.T) {
+	types, err := splitSignature("susssasa{sv}i(ub)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"s", "u", "s", "s", "s", "as", "a{sv}", "i", "(ub)"}
+	if !reflect.DeepEqual(types, want) {
+		t.Errorf("splitSignature() = %q, want %q", types, want)
+	}
+	for _, signature := range []string{"a", "a{sv", "(s", "z"} {
+		if _, err := splitSignature(signature); err == nil {
+			t.Errorf("splitSignature(%q) accepted an invalid signature", signature)
+		}
+	}
+}
+
+func TestDBusMessageRoundTrip(t *testing.T) {
+	m := &DBusMessage{
+		Type:        dbusMethodCall,
+		Serial:      7,
+		Path:        notificationsPath,
+		Interface:   notificationsName,
+		Member:      "Notify",
+		Destination: notificationsName,
+		Signature:   "susssasa{sv}i",
+		Body: []any{programName, uint32(41), "clock", "title", "time for a break",
+			[]string{"snooze", "Snooze 5m"},
+			map[string]DBusVariant{"urgency": {Signature: "y", Value: byte(2)}},
+			int32(-1)},
+	}
+	data, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[0] != 'l' || data[1] != dbusMethodCall {
+		t.Fatalf("Marshal() produced a malformed header: % x", data[:16])
+	}
+	got, err := ReadDBusMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Type != m.Type || got.Serial != m.Serial || got.Path != m.Path || got.Interface != m.Interface ||
+		got.Member != m.Member || got.Destination != m.Destination || got.Signature != m.Signature {
+		t.Errorf("header = %+v, want %+v", got, m)
+	}
+	want := []any{programName, uint32(41), "clock", "title", "time for a break",
+		[]any{"snooze", "Snooze 5m"},
+		[]any{[]any{"urgency", DBusVariant{Signature: "y", Value: byte(2)}}},
+		int32(-1)}
+	if !reflect.DeepEqual(got.Body, want) {
+		t.Errorf("body = %#v, want %#v", got.Body, want)
+	}
+}
+
+func TestDBusMessageSignatureMismatch(t *testing.T) {
+	m := &DBusMessage{Type: dbusSignal, Signature: "us", Body: []any{uint32(1)}}
+	if _, err := m.Marshal(); err == nil {
+		t.Error("Marshal() accepted a body that does not match the signature")
+	}
+	m = &DBusMessage{Type: dbusSignal, Signature: "u", Body: []any{"1"}}
+	if _, err := m.Marshal(); err == nil {
+		t.Error("Marshal() accepted a string for a uint32")
+	}
+}
+
+// bus that accepts one connection, answers every method call with an empty reply, hello with a
+// unique name, and sends the signals written to its channel
+type fakeBus struct {
+	path    string
+	signals chan *DBusMessage
+	calls   chan *DBusMessage
+}
+
+func newFakeBus(t *testing.T) *fakeBus {
+	b := &fakeBus{
+		path:    filepath.Join(t.TempDir(), "bus"),
+		signals: make(chan *DBusMessage),
+		calls:   make(chan *DBusMessage, 16),
+	}
+	listener, err := net.Listen("unix", b.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		line, err := reader.ReadString('\n')
+		if err != nil || !strings.HasPrefix(line, "\x00AUTH EXTERNAL ") {
+			return
+		}
+		conn.Write([]byte("OK 0123456789abcdef\r\n"))
+		if line, err = reader.ReadString('\n'); err != nil || line != "BEGIN\r\n" {
+			return
+		}
+		var serial uint32
+		var mutex sync.Mutex // replies and signals are written from two goroutines
+		write := func(m *DBusMessage) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			serial++
+			m.Serial = serial
+			data, err := m.Marshal()
+			if err == nil {
+				conn.Write(data)
+			}
+		}
+		go func() {
+			for m := range b.signals {
+				write(m)
+			}
+		}()
+		for {
+			m, err := ReadDBusMessage(reader)
+			if err != nil {
+				return
+			}
+			b.calls <- m
+			reply := &DBusMessage{Type: dbusMethodReturn, ReplySerial: m.Serial}
+			if m.Member == "Hello" {
+				reply.Signature, reply.Body = "s", []any{":1.42"}
+			}
+			write(reply)
+		}
+	}()
+	return b
+}
+
+func (b *fakeBus) signal(member, signature string, args ...any) {
+	b.signals <- &DBusMessage{
+		Type:      dbusSignal,
+		Path:      notificationsPath,
+		Interface: notificationsName,
+		Member:    member,
+		Signature: signature,
+		Body:      args,
+	}
+}
+
+func TestDialBus(t *testing.T) {
+	bus := newFakeBus(t)
+	conn, err := DialBus(bus.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if conn.Name != ":1.42" {
+		t.Errorf("Name = %q, want the name assigned by hello", conn.Name)
+	}
+	err = conn.AddMatch("type='signal',member='ActionInvoked'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-bus.calls // hello
+	if m := <-bus.calls; m.Member != "AddMatch" || m.Signature != "s" {
+		t.Errorf("AddMatch sent %v(%v)", m.Member, m.Signature)
+	}
+}
+
+func TestListenActions(t *testing.T) {
+	bus := newFakeBus(t)
+	conn, err := DialBus(bus.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	EnableNotificationActions()
+	actionBus.Lock()
+	actionBus.timers[7] = "work"
+	actionBus.timers[8] = "study"
+	actionBus.Unlock()
+
+	invoked := make(chan [2]string, 4)
+	go listenActions(conn.Signals, func(name, key string) { invoked <- [2]string{name, key} })
+	expect := func(want [2]string) {
+		t.Helper()
+		select {
+		case got := <-invoked:
+			if got != want {
+				t.Errorf("invoked %v, want %v", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("action %v was not invoked", want)
+		}
+	}
+
+	bus.signal("ActionInvoked", "us", uint32(7), "snooze")
+	expect([2]string{"work", "snooze"})
+	bus.signal("ActionInvoked", "us", uint32(99), "stop") // sent by another program
+	bus.signal("NotificationClosed", "uu", uint32(7), uint32(2))
+	bus.signal("ActionInvoked", "us", uint32(7), "skip") // closed, no longer ours
+	bus.signal("ActionInvoked", "us", uint32(8), "break")
+	expect([2]string{"study", "break"})
+
+	actionBus.Lock()
+	_, open := actionBus.timers[7]
+	_, kept := actionBus.timers[8]
+	actionBus.Unlock()
+	if open || !kept {
+		t.Errorf("timers = %v, want only the notification that was not closed", actionBus.timers)
+	}
+	select {
+	case got := <-invoked:
+		t.Errorf("unexpected action %v", got)
+	default:
+	}
+}
@@ -12,7 +12,7 @@ import (
 func (t *Task) RunInline() error {
 	var userCmd bool                      // user input command string accepted
 	redrawRate := 1 * time.Second         // inline redraw
-	updateRate := 5 * time.Second         // config update (we don't watch for file changes)
+	updateRate := 5 * time.Second         // config update when file changes can not be watched
 	redraw := time.NewTicker(redrawRate)  // render current inline timer
 	update := time.NewTicker(updateRate)  // change config/state of inline timer
 	quitting := make(chan os.Signal, 1)   // signal a clean up before exit
@@ -20,6 +20,13 @@ func (t *Task) RunInline() error {
 	input := make(chan int)               // send update (1) or quit (0) message
 	signal.Notify(quitting, os.Interrupt) // handle os kill program
 
+	changed, err := WatchFiles(WatchDirectories()...) // reload as soon as another command saves
+	if err != nil {
+		t.State.Debug.Print("RunInline(): polling for changes,", err)
+	} else {
+		update.Stop()
+	}
+
 	Stty("-echo")                                               // turn stty echo off
 	fmt.Printf("%v%v%v", cursorPrevLine, clearLine, cursorHide) // initial clear & hide
 	t.Render()                                                  // display initial timer
@@ -41,7 +48,7 @@ func (t *Task) RunInline() error {
 					os.Exit(0)
 				}
 				if msg == 1 {
-					updatedTask, err := InitializeTimer()
+					updatedTask, err := InitializeNamedTimer(t.State.Name)
 					if err != nil {
 						os.Exit(0)
 					}
@@ -56,11 +63,22 @@ func (t *Task) RunInline() error {
 				t.GetTime()
 				t.Render()
 			case <-update.C: // get a new State and Config
-				updatedTask, err := InitializeTimer()
+				updatedTask, err := InitializeNamedTimer(t.State.Name)
+				if err != nil {
+					break
+				}
+				t = &updatedTask
+			case <-changed: // state or config saved, show the change right away
+				updatedTask, err := InitializeNamedTimer(t.State.Name)
 				if err != nil {
 					break
 				}
 				t = &updatedTask
+				if userCmd {
+					break
+				}
+				fmt.Printf("%v%v", clearLine, carriageReturn)
+				t.Render()
 			}
 		}
 	}()
@@ -80,27 +98,37 @@ func (t *Task) Read(ch chan int) {
 			}
 			if input == "b" || input == "break" {
 				fmt.Printf("%v%vtake a break", clearLine, carriageReturn)
-				t.Break()
+				t.Dispatch("break")
 				ch <- 1
 			}
 			if input == "t" || input == "stop" {
 				fmt.Printf("%v%vstop timer", clearLine, carriageReturn)
-				t.Stop()
+				t.Dispatch("stop")
 				ch <- 1
 			}
 			if input == "s" || input == "start" {
 				fmt.Printf("%v%vstart timer", clearLine, carriageReturn)
-				t.Start()
+				t.Dispatch("start")
 				ch <- 1
 			}
 			if input == "p" || input == "pause" {
 				fmt.Printf("%v%vpause timer", clearLine, carriageReturn)
-				t.Pause()
+				t.Dispatch("pause")
 				ch <- 1
 			}
 			if input == "r" || input == "resume" {
 				fmt.Printf("%v%vresume timer", clearLine, carriageReturn)
-				t.Resume()
+				t.Dispatch("resume")
+				ch <- 1
+			}
+			if input == "l" || input == "lap" {
+				fmt.Printf("%v%vlap", clearLine, carriageReturn)
+				t.Dispatch("lap")
+				ch <- 1
+			}
+			if adjust, d, ok := ParseAdjustInput(input); ok {
+				fmt.Printf("%v%v%v %v", clearLine, carriageReturn, adjust, d)
+				t.Dispatch(adjust, d.String())
 				ch <- 1
 			}
 			if input == "c" || input == "clear" { // clear terminal screen, but leave scrollback
@@ -115,21 +143,77 @@ func (t *Task) Read(ch chan int) {
 	}
 }
 
+// inline time changes: +, extend, - and shorten take an optional duration, = takes the elapsed time,
+// e.g. "+", "+10m", "shorten" or "=20m"
+func ParseAdjustInput(input string) (string, time.Duration, bool) {
+	var command, value string
+	switch {
+	case strings.HasPrefix(input, "extend"):
+		command, value = "extend", strings.TrimPrefix(input, "extend")
+	case strings.HasPrefix(input, "shorten"):
+		command, value = "shorten", strings.TrimPrefix(input, "shorten")
+	case strings.HasPrefix(input, "+"):
+		command, value = "extend", input[1:]
+	case strings.HasPrefix(input, "-"):
+		command, value = "shorten", input[1:]
+	case strings.HasPrefix(input, "="):
+		command, value = "elapsed", input[1:]
+	default:
+		return "", 0, false
+	}
+	if value == "" && command != "elapsed" {
+		return command, adjustStep, true
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return "", 0, false
+	}
+	return command, d, true
+}
+
+// send an inline command to the daemon, or run it directly
+func (t *Task) Dispatch(command string, args ...string) {
+	_, err := Dispatch(Request{Command: command, Name: t.State.Name, Args: args})
+	if err != nil {
+		t.State.Debug.Print("Dispatch():", command, err)
+	}
+}
+
 // prints timer output to terminal
 func (t *Task) Render() {
-	fmt.Printf("%v%v%v%v%v%v", t.DrawIcon(), t.DrawTask(), t.DrawBar(), t.DrawTime(), t.DrawPercent(), t.RingBell())
+	fmt.Printf("%v%v", t.RenderString(), t.RingBell())
+}
+
+// timer output using the configured format or the default layout
+func (t *Task) RenderString() string {
+	if format := t.GetFormat(); format != "" {
+		return t.ExpandFormat(format)
+	}
+	return fmt.Sprintf("%v%v%v%v%v%v%v", t.DrawIcon(), t.DrawTask(), t.DrawBar(), t.DrawTime(), t.DrawLap(), t.DrawPercent(), t.DrawShowEnd())
+}
+
+// projected end time in the default layout, when enabled in config
+func (t *Task) DrawShowEnd() string {
+	end := t.DrawEnd()
+	if !t.Config.ShowEnd || end == "" {
+		return ""
+	}
+	return fmt.Sprintf(" %v", t.Paint("time", "→"+end))
 }
 
 // display user task string
 func (t *Task) DrawTask() string {
 	task := t.State.GetTask()
+	if phase, ok := t.State.CurrentPhase(); ok && !t.State.TimerIsStopped() {
+		task = strings.TrimSpace(phase.Name + " " + task) // routine phase leads the task string
+	}
 	if len(task) == 0 || t.Config.HideTask {
 		return ""
 	}
 	if len(task) > t.Config.TaskLength {
-		return fmt.Sprintf("%v ", task[:t.Config.TaskLength])
+		return fmt.Sprintf("%v ", t.Paint("task", task[:t.Config.TaskLength]))
 	}
-	return fmt.Sprintf("%v ", t.State.GetTask())
+	return fmt.Sprintf("%v ", t.Paint("task", task))
 }
 
 // display clock
@@ -141,31 +225,33 @@ func (t *Task) DrawTime() string {
 		return ""
 	}
 	switch {
+	case t.State.Stopwatch: // counts up, the target does not change the display
+		return fmt.Sprintf(" %v", t.Paint("time", t.FormatTime(t.State.GetStopwatchElapsed())))
 	case t.Config.ReverseTime:
 		switch {
 		case t.State.TimerHasExpired():
-			return fmt.Sprintf(" %v", t.FormatTime(t.State.TimeInterval-t.State.TimeInterval))
+			return fmt.Sprintf(" %v", t.Paint("time", t.FormatTime(t.State.GetInterval()-t.State.GetInterval())))
 		case t.State.TimerIsPaused() && t.State.TimerOnBreak():
-			return fmt.Sprintf(" %v", t.FormatTime(t.State.GetRemainingPausedBreak()))
+			return fmt.Sprintf(" %v", t.Paint("time", t.FormatTime(t.State.GetRemainingPausedBreak())))
 		case t.State.TimerIsPaused() && !t.State.TimerOnBreak():
-			return fmt.Sprintf(" %v", t.FormatTime(t.State.GetRemainingPaused()))
+			return fmt.Sprintf(" %v", t.Paint("time", t.FormatTime(t.State.GetRemainingPaused())))
 		case !t.State.TimerIsPaused() && t.State.TimerOnBreak():
-			return fmt.Sprintf(" %v", t.FormatTime(t.State.GetRemainingBreak()))
+			return fmt.Sprintf(" %v", t.Paint("time", t.FormatTime(t.State.GetRemainingBreak())))
 		default:
-			return fmt.Sprintf(" %v", t.FormatTime(t.State.GetIntervalRemaining()))
+			return fmt.Sprintf(" %v", t.Paint("time", t.FormatTime(t.State.GetIntervalRemaining())))
 		}
 	default:
 		switch {
 		case t.State.TimerHasExpired():
-			return fmt.Sprintf(" %v", t.FormatTime(t.State.TimeInterval))
+			return fmt.Sprintf(" %v", t.Paint("time", t.FormatTime(t.State.GetInterval())))
 		case t.State.TimerIsPaused() && t.State.TimerOnBreak():
-			return fmt.Sprintf(" %v", t.FormatTime(t.State.GetElapsedPausedBreak()))
+			return fmt.Sprintf(" %v", t.Paint("time", t.FormatTime(t.State.GetElapsedPausedBreak())))
 		case t.State.TimerIsPaused() && !t.State.TimerOnBreak():
-			return fmt.Sprintf(" %v", t.FormatTime(t.State.GetElapsedPaused()))
+			return fmt.Sprintf(" %v", t.Paint("time", t.FormatTime(t.State.GetElapsedPaused())))
 		case !t.State.TimerIsPaused() && t.State.TimerOnBreak():
-			return fmt.Sprintf(" %v", t.FormatTime(t.State.GetElapsedBreak()))
+			return fmt.Sprintf(" %v", t.Paint("time", t.FormatTime(t.State.GetElapsedBreak())))
 		default:
-			return fmt.Sprintf(" %v", t.FormatTime(t.State.GetElapsed()))
+			return fmt.Sprintf(" %v", t.Paint("time", t.FormatTime(t.State.GetElapsed())))
 		}
 	}
 }
@@ -175,62 +261,74 @@ func (t *Task) DrawPercent() string {
 	if !t.Config.Percent {
 		return ""
 	}
-	var percent int
-	switch {
-	case t.State.TimerIsStopped():
+	if t.State.TimerIsStopped() {
 		return ""
-	case t.State.TimerHasExpired():
-		percent = 100
-	case t.State.TimerOnBreak() && t.State.TimerIsPaused():
-		percent = int(float64(t.State.GetElapsedPausedBreak()) / float64(t.State.TimeBreak) * 100.0)
-	case t.State.TimerOnBreak() && !t.State.TimerIsPaused():
-		percent = int(float64(t.State.GetElapsedBreak()) / float64(t.State.TimeBreak) * 100.0)
-	case !t.State.TimerOnBreak() && t.State.TimerIsPaused():
-		percent = int(float64(t.State.GetElapsedPaused()) / float64(t.State.TimeInterval) * 100.0)
-	default:
-		percent = int(float64(t.State.GetElapsed()) / float64(t.State.TimeInterval) * 100.0)
 	}
-	return fmt.Sprintf("%v%%", FormatPercent(percent))
+	return fmt.Sprintf("%v%%", FormatPercent(t.State.GetPercent()))
 }
 
 // render progress as filled bar characters
 func (t *Task) DrawBar() string {
-	if t.Config.HideBar {
+	if t.Config.HideBar || (t.State.Stopwatch && t.State.Target <= 0) {
 		return ""
 	}
 	var bar, done, todo string
 	var scale int
+	if mode := t.Progress["mode"]; mode != "" && !t.State.TimerIsStopped() {
+		return t.DrawPartialBar(mode)
+	}
 	switch {
 	case t.State.TimerIsStopped():
 		return fmt.Sprintf("%v", bar)
-	case t.State.TimerHasExpired():
+	case !t.State.Stopwatch && t.State.TimerHasExpired():
 		bar = strings.Repeat(t.Progress["done"], t.Config.BarSize)
-		return fmt.Sprintf("%v", bar)
-	case t.State.TimerIsPaused():
-		if t.State.TimerOnBreak() {
-			scale = int(float64(t.Config.BarSize) * float64(t.State.GetElapsedPausedBreak()) / float64(t.State.TimeBreak))
-		}
-		if !t.State.TimerOnBreak() {
-			scale = int(float64(t.Config.BarSize) * float64(t.State.GetElapsedPaused()) / float64(t.State.TimeInterval))
-		}
-	case !t.State.TimerIsPaused():
-		if t.State.TimerOnBreak() {
-			scale = int(float64(t.Config.BarSize) * float64(t.State.GetElapsedBreak()) / float64(t.State.TimeBreak))
-		}
-		if !t.State.TimerOnBreak() {
-			scale = int(float64(t.Config.BarSize) * float64(t.State.GetElapsed()) / float64(t.State.TimeInterval))
-		}
+		return fmt.Sprintf("%v", t.Paint("done", bar))
 	}
+	// stopwatch progress is measured against the target
+	scale = int(float64(t.Config.BarSize) * t.State.GetProgress())
 	if scale < 0 { // NOTE prevents negative repeat crashes.  This could happen if system time is changed while program is running
 		return ""
 	}
-	done = strings.Repeat(t.Progress["done"], scale)
-	if (t.Config.BarSize - scale) < 0 {
-		t.State.Debug.Print("NEGATIVE BAR")
-		t.State.Debug.Print("t.Config.Barsize: ", t.Config.BarSize, "scale: ", scale)
+	if scale > t.Config.BarSize { // stopwatch past its target
+		scale = t.Config.BarSize
 	}
+	done = strings.Repeat(t.Progress["done"], scale)
 	todo = strings.Repeat(t.Progress["todo"], t.Config.BarSize-scale)
-	return fmt.Sprintf("%v%v", done, todo)
+	return fmt.Sprintf("%v%v", t.Paint("done", done), t.Paint("todo", todo))
+}
+
+// render progress with sub-cell precision, every step is an eighth of a cell
+func (t *Task) DrawPartialBar(mode string) string {
+	partials, ok := barPartials[mode]
+	if !ok {
+		t.State.Debug.Print("DrawPartialBar(): unknown bar mode", mode)
+		return ""
+	}
+	progress := t.State.GetProgress()
+	if progress < 0 { // system time changed while running
+		return ""
+	}
+	if progress > 1 {
+		progress = 1
+	}
+	if mode == barModeVertical {
+		step := int(progress * float64(len(partials)))
+		if step >= len(partials) {
+			return t.Paint("done", t.Progress["done"])
+		}
+		return t.Paint("done", partials[step])
+	}
+	size := t.Config.BarSize
+	eighths := int(progress * float64(size*len(partials)))
+	full := eighths / len(partials)
+	done := strings.Repeat(t.Progress["done"], full)
+	cells := full
+	if step := eighths % len(partials); step > 0 {
+		done += partials[step]
+		cells++
+	}
+	todo := strings.Repeat(t.Progress["todo"], size-cells)
+	return fmt.Sprintf("%v%v", t.Paint("done", done), t.Paint("todo", todo))
 }
 
 // display the timer's mode with an icon
@@ -240,41 +338,27 @@ func (t *Task) DrawIcon() string {
 	}
 	switch {
 	case t.State.TimerIsStopped():
-		return fmt.Sprintf("%v ", t.Symbols["stopped"])
+		return fmt.Sprintf("%v ", t.Paint("icon", t.Symbols["stopped"]))
 	case t.State.TimerHasExpired():
-		return fmt.Sprintf("%v ", t.Symbols["expired"])
+		return fmt.Sprintf("%v ", t.Paint("icon", t.Symbols["expired"]))
 	case t.State.TimerIsPaused() && !t.State.TimerOnBreak():
-		return fmt.Sprintf("%v ", t.Symbols["paused"])
+		return fmt.Sprintf("%v ", t.Paint("icon", t.Symbols["paused"]))
 	case t.State.TimerIsPaused() && t.State.TimerOnBreak():
-		return fmt.Sprintf("%v ", t.Symbols["breakp"])
+		return fmt.Sprintf("%v ", t.Paint("icon", t.Symbols["breakp"]))
 	case !t.State.TimerIsPaused() && t.State.TimerOnBreak():
-		return fmt.Sprintf("%v ", t.Symbols["break"])
+		return fmt.Sprintf("%v ", t.Paint("icon", t.Symbols["break"]))
 	case t.State.TimerOnAlert():
-		return fmt.Sprintf("%v ", t.Symbols["warning"])
+		return fmt.Sprintf("%v ", t.Paint("icon", t.Symbols["warning"]))
 	default:
-		return fmt.Sprintf("%v ", t.Symbols["on"])
+		return fmt.Sprintf("%v ", t.Paint("icon", t.Symbols["on"]))
 	}
 }
 
-// sound old school terminal bell
+// sound old school terminal bell when this process fired an event
 func (t *Task) RingBell() string {
-	// skip if disabled bell in config, timer is stopped or paused
-	if !t.Config.Bell || t.State.TimerIsStopped() || t.State.TimerIsPaused() {
+	if !t.Config.Bell || len(t.Fired) == 0 {
 		return ""
 	}
-	redrawRate := 1 * time.Second
-	// set threshold a few milliseconds greater than the refresh rate to ensure the bell triggers at least once
-	switch {
-	case t.State.TimerOnBreak():
-		if (t.State.GetTotal()-t.State.GetElapsed()) < time.Duration(redrawRate+(100*time.Millisecond)) && (t.State.GetTotal()-t.State.GetElapsed()) > time.Duration(0*time.Second) {
-			t.State.Debug.Print("BREAK COMPLETE BELL")
-			return fmt.Sprintf("\a")
-		}
-	case !t.State.TimerOnBreak():
-		if t.State.GetIntervalRemaining() < time.Duration(redrawRate+(100*time.Millisecond)) && t.State.GetIntervalRemaining() > time.Duration(0*time.Second) {
-			t.State.Debug.Print("INTERVAL COMPLETE BELL")
-			return fmt.Sprintf("\a")
-		}
-	}
-	return ""
+	t.State.Debug.Print("BELL:", t.Fired)
+	return fmt.Sprintf("\a")
 }
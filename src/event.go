@@ -0,0 +1,150 @@
+package main
+
+import "time"
+
+// timer events, each fires once from whichever process sees it first
+const (
+	eventAlert       = "alert"        // an alert threshold of the interval or break is reached
+	eventIntervalEnd = "interval-end" // end of the interval, or of a work phase
+	eventBreakEnd    = "break-end"
+)
+
+// event due for the current interval or break that has not been fired; ends missed while nothing
+// was running are fired after the fact in order, the interval end before the break end
+func (s *State) PendingEvent() string {
+	switch {
+	case s.TimerIsStopped():
+		return ""
+	case s.TimerHasExpired() && s.NotifiedBreak.Before(s.GetBreakEnd()) && s.GetInterval() > 0 &&
+		s.NotifiedInterval.Before(s.GetWorkEnd()):
+		return eventIntervalEnd // missed, or with no break to follow it ends the run
+	case s.TimerHasExpired() && s.NotifiedBreak.Before(s.GetBreakEnd()):
+		return eventBreakEnd
+	case s.TimerOnBreak() && s.GetInterval() > 0 && s.NotifiedInterval.Before(s.GetWorkEnd()):
+		return eventIntervalEnd
+	}
+	// only the latest threshold reached fires, earlier ones missed in between are skipped
+	if s.AlertDue() {
+		return eventAlert
+	}
+	return ""
+}
+
+// time an alert is reached or the running interval or break ends, zero when the timer is stopped, paused or expired
+func (s *State) NextEventTime() time.Time {
+	switch {
+	case s.TimerIsStopped() || s.TimerIsPaused() || s.TimerHasExpired() || s.Stopwatch:
+		return time.Time{}
+	case !s.NextAlertTime().IsZero():
+		return s.NextAlertTime()
+	case !s.TimerOnBreak() && s.GetInterval() > 0:
+		return s.GetWorkEnd()
+	}
+	return s.GetBreakEnd()
+}
+
+// mark the event as fired in the state file; the file is read back first, and if another process
+// has fired the event already its state replaces ours and the event is not claimed
+func (t *Task) ClaimEvent(event string) bool {
+	saved := State{Name: t.State.Name, Debug: t.State.Debug}
+	saved.Load()
+	if saved.PendingEvent() != event {
+		t.State.Debug.Print("ClaimEvent():", event, "already fired")
+		*t.State = saved
+		return false
+	}
+	// ends are marked at the time they were due, so an end missed in the routine phase that follows
+	// is still pending once the phase has moved on
+	switch event {
+	case eventAlert:
+		t.State.NotifiedAlert = time.Now()
+		t.State.AlertPhase = t.State.alertPhase()
+		t.State.AlertFired = t.State.ReachedAlert()
+	case eventIntervalEnd:
+		t.State.NotifiedInterval = t.State.GetWorkEnd()
+		if t.State.GetBreak() == 0 { // no break follows, the interval end is the end of the run
+			t.State.NotifiedBreak = t.State.GetBreakEnd()
+		}
+	default:
+		t.State.NotifiedInterval = t.State.GetWorkEnd()
+		t.State.NotifiedBreak = t.State.GetBreakEnd()
+	}
+	err := t.State.Save()
+	if err != nil {
+		t.State.Debug.Print("ClaimEvent()", err)
+		return false
+	}
+	return true
+}
+
+// fire the pending events, then restart the timer or move to the next routine phase; routine
+// phases that ended while nothing was running are moved through one at a time, each firing its end
+func (t *Task) UpdateEvents() {
+	for {
+		event := t.State.PendingEvent()
+		if event == "" || !t.ClaimEvent(event) {
+			return
+		}
+		t.Emit(event)
+		if event != eventAlert && t.State.EndFired() {
+			t.nextAfterEnd()
+		}
+	}
+}
+
+// true once the end of the run, or of the routine phase, has fired
+func (s *State) EndFired() bool {
+	return s.TimerHasExpired() && !s.NotifiedBreak.Before(s.GetBreakEnd())
+}
+
+// restart the timer or move to the next routine phase once the end of the run has fired
+func (t *Task) nextAfterEnd() {
+	switch {
+	case t.State.InRoutine():
+		t.NextPhase() // advance routine, restart is handled per phase
+		if phase, ok := t.State.CurrentPhase(); ok && phase.IsBreak() {
+			t.QueueHook(hookBreakStart)
+		}
+	case t.Config.Restart:
+		t.Restart()
+	}
+}
+
+// deliver an event claimed by this process
+func (t *Task) Emit(event string) {
+	switch {
+	case event == eventAlert:
+		t.QueueHook(hookAlert)
+		t.Fired = append(t.Fired, event)
+		t.SendNotifications(event)
+		return
+	case event == eventIntervalEnd:
+		t.QueueHook(hookIntervalEnd)
+		if t.State.GetBreak() > 0 {
+			t.QueueHook(hookBreakStart)
+		}
+	default:
+		t.QueueHook(hookBreakEnd)
+	}
+	t.Fired = append(t.Fired, event)
+	t.SendNotifications(event)
+	if event == eventBreakEnd {
+		t.Message("break over")
+		return
+	}
+	t.Message("completed")
+}
+
+// message describing what follows the event
+func (t *Task) EventMessage(event string) string {
+	switch event {
+	case eventAlert:
+		d := t.State.ReachedAlert()
+		return alertMessage(d)
+	case eventIntervalEnd:
+		if t.State.GetBreak() > 0 {
+			return messageBreak
+		}
+	}
+	return t.NextMessage()
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const icsTimeFormat = "20060102T150405Z"
+
+var exportFormats = map[string]func(io.Writer, []Session) error{
+	"csv":  ExportCSV,
+	"json": ExportJSON,
+	"ics":  ExportICS,
+}
+
+// sessions starting inside [since, until), zero times leave the range open
+func FilterSessions(sessions []Session, name string, since, until time.Time) []Session {
+	var selected []Session
+	for _, s := range sessions {
+		if name != "" && s.Timer != name {
+			continue
+		}
+		if !since.IsZero() && s.Start.Before(since) {
+			continue
+		}
+		if !until.IsZero() && !s.Start.Before(until) {
+			continue
+		}
+		selected = append(selected, s)
+	}
+	return selected
+}
+
+// parse a local calendar date, until dates include the whole day
+func ParseExportDate(value string, until bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	date, err := time.ParseInLocation(reportDayFormat, value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("'%v' invalid: dates use the format %v", value, reportDayFormat)
+	}
+	if until {
+		date = date.AddDate(0, 0, 1)
+	}
+	return date, nil
+}
+
+// one row per session, breaks are separated by the kind column and pauses by the paused column
+func ExportCSV(w io.Writer, sessions []Session) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"timer", "kind", "phase", "task", "start", "end", "active", "paused", "completed"})
+	for _, s := range sessions {
+		writer.Write([]string{
+			s.Timer,
+			s.Kind,
+			s.Phase,
+			s.Task,
+			s.Start.Local().Format(time.RFC3339),
+			s.End.Local().Format(time.RFC3339),
+			strconv.Itoa(int(s.Active().Seconds())),
+			strconv.Itoa(int(s.Paused.Seconds())),
+			strconv.FormatBool(s.Completed),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// json array of sessions with durations in seconds
+func ExportJSON(w io.Writer, sessions []Session) error {
+	type record struct {
+		Timer     string    `json:"timer"`
+		Kind      string    `json:"kind"`
+		Phase     string    `json:"phase,omitempty"`
+		Task      string    `json:"task"`
+		Start     time.Time `json:"start"`
+		End       time.Time `json:"end"`
+		Active    int       `json:"active"`
+		Paused    int       `json:"paused"`
+		Completed bool      `json:"completed"`
+	}
+	records := []record{}
+	for _, s := range sessions {
+		records = append(records, record{s.Timer, s.Kind, s.Phase, s.Task, s.Start, s.End,
+			int(s.Active().Seconds()), int(s.Paused.Seconds()), s.Completed})
+	}
+	bytes, err := json.MarshalIndent(records, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", bytes)
+	return err
+}
+
+// one VEVENT per session; work and breaks are told apart by CATEGORIES
+func ExportICS(w io.Writer, sessions []Session) error {
+	var b strings.Builder
+	line := func(format string, a ...interface{}) {
+		b.WriteString(foldICS(fmt.Sprintf(format, a...)))
+		b.WriteString("\r\n")
+	}
+	stamp := time.Now().UTC().Format(icsTimeFormat)
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//%v//EN", programName)
+	for _, s := range sessions {
+		summary := s.Task
+		if summary == "" {
+			summary = s.Kind
+		}
+		status := "completed"
+		if !s.Completed {
+			status = "stopped early"
+		}
+		line("BEGIN:VEVENT")
+		line("UID:%v-%v-%d@%v", s.Timer, s.Kind, s.Start.UnixNano(), programName)
+		line("DTSTAMP:%v", stamp)
+		line("DTSTART:%v", s.Start.UTC().Format(icsTimeFormat))
+		line("DTEND:%v", s.End.UTC().Format(icsTimeFormat))
+		line("SUMMARY:%v", escapeICS(summary))
+		line("CATEGORIES:%v", strings.ToUpper(s.Kind))
+		line("DESCRIPTION:%v", escapeICS(fmt.Sprintf("timer: %v\nactive: %v\npaused: %v\n%v",
+			s.Timer, s.Active().Round(time.Second), s.Paused.Round(time.Second), status)))
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func escapeICS(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
+
+// fold content lines longer than 75 octets, without splitting utf-8 sequences
+func foldICS(s string) string {
+	const limit = 75
+	var b strings.Builder
+	var size int
+	for _, r := range s {
+		n := len(string(r))
+		if size+n > limit {
+			b.WriteString("\r\n ")
+			size = 1
+		}
+		b.WriteRune(r)
+		size += n
+	}
+	return b.String()
+}
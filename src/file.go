@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
 	"log"
 	"os"
@@ -12,12 +11,17 @@ import (
 )
 
 const (
-	StateFile     = "state.json"  // timer state file
-	ConfigFile    = "config.json" // configuration file
-	TimerFile     = "timer.log"   // timer log file
-	DebugFile     = "debug.log"   // debug log file
-	EnableDebug   = false         // false removes debug printing to log
+	StateFile     = "state.json"     // timer state file
+	DefaultTimer  = "default"        // name of the timer using StateFile
+	ConfigFile    = "config.json"    // configuration file
+	TimerFile     = "timer.log"      // timer log file
+	SessionFile   = "sessions.jsonl" // completed intervals and breaks, one json record per line
+	DebugFile     = "debug.log"      // debug log file
+	HookFile      = "hooks.log"      // hooks that failed or timed out, always written
+	EnableDebug   = false            // false removes debug printing to log
 	LogTimeFormat = time.Kitchen
+	lockSuffix    = ".lock"    // advisory lock file next to the file it guards
+	corruptSuffix = ".corrupt" // unreadable state files are moved aside with this suffix
 )
 
 var TimeStamp = time.Now().Format(LogTimeFormat)
@@ -42,38 +46,56 @@ func createDirectory(path string) error {
 
 // return bytes of file at given path
 func readFile(path string) ([]byte, error) {
-	file, err := os.Open(path)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	stat, err := file.Stat()
-	if err != nil {
-		return nil, err
-	}
-
-	bytes := make([]byte, stat.Size())
-	_, err = bufio.NewReader(file).Read(bytes)
-	if err != nil {
-		return nil, err
-	}
-	return bytes, nil
+	return os.ReadFile(path)
 }
 
-// write bytes to a file
+// write bytes to a temporary file and rename it over path, readers see the old or the new file but
+// never a partial one
 func writeFile(path string, bytes []byte) error {
-	file, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0644)
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	defer os.Remove(file.Name()) // no-op once renamed
 
 	_, err = file.Write(bytes)
+	if err == nil {
+		err = file.Sync()
+	}
+	if err == nil {
+		err = file.Chmod(0644)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
 		return err
 	}
-	return nil
+	return os.Rename(file.Name(), path)
+}
+
+// directories holding the state and configuration files, watched for changes by run and daemon
+func WatchDirectories() []string {
+	var dirs []string
+	if dir, err := StateDirectory(); err == nil {
+		dirs = append(dirs, dir)
+	}
+	if path, err := ConfigPath(); err == nil {
+		dirs = append(dirs, filepath.Dir(path))
+	}
+	return dirs
+}
+
+// report a file that could not be parsed on stderr and move it aside, so it can be inspected and
+// the error is reported once
+func reportCorrupt(path string, err error) {
+	moved := path + corruptSuffix
+	renameErr := os.Rename(path, moved)
+	if renameErr != nil {
+		fmt.Fprintf(os.Stderr, "%v: %v is corrupt: %v\n", programName, path, err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%v: %v is corrupt, moved to %v: %v\n", programName, path, moved, err)
 }
 
 // delete file at given path
@@ -125,7 +147,9 @@ func ReturnLogFile(filename string) (*os.File, error) {
 	_, err = checkFilePath(filepath.Dir(path))
 	if err != nil {
 		err = createDirectory(filepath.Dir(path))
-		return nil, err
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
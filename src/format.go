@@ -14,10 +14,16 @@ const (
 	cursorPrevLine    = "\033[1A"
 	fileDescriptor    = "/proc/self/fd/0"
 	altFileDescriptor = "/dev/fd/0"
+	timerSeparator    = "  "
 
 	messageBreak = "time for a break"
 	messageWork  = "time to work"
 	messageDone  = "time complete"
+	messagePhase = "time for %v (%v)"
+
+	barModeSmooth   = "smooth"   // eighth block leading edge
+	barModeVertical = "vertical" // single glyph
+	barModeBraille  = "braille"  // braille dot leading edge
 )
 
 // run an stty command using the constant fileDescriptor path or alternate path
@@ -56,6 +62,43 @@ var stateString = map[string]string{
 	"tmux":    "tmux",
 }
 
+// keys every icon set and bar style provides; custom sets fall back per key
+var iconKeys = []string{"on", "warning", "paused", "stopped", "edit", "expired", "break", "breakp", "notify", "tmux", "restart"}
+var barKeys = []string{"done", "todo", "stop"}
+
+// built-in icon sets and bar styles by name, numbered in the order of the style command
+var iconSets = map[string]map[string]string{
+	"solid": icon_solid,
+	"trace": icon_trace,
+	"ascii": icon_ascii,
+}
+var barStyles = map[string]map[string]string{
+	"solid":     bar_solid,
+	"solid_rev": bar_solid_rev,
+	"shade":     bar_shade,
+	"shade_rev": bar_shade_rev,
+	"ascii":     bar_ascii,
+	"smooth":    bar_smooth,
+	"vertical":  bar_vertical,
+	"braille":   bar_braille,
+}
+
+// copy a symbol set, taking every key missing from it from the fallback set
+func MergeSymbols(set, fallback map[string]string, keys []string) (map[string]string, []string) {
+	var missing []string
+	merged := map[string]string{}
+	for k, v := range set {
+		merged[k] = v
+	}
+	for _, key := range keys {
+		if _, ok := set[key]; !ok {
+			merged[key] = fallback[key]
+			missing = append(missing, key)
+		}
+	}
+	return merged, missing
+}
+
 // 󱎫 󱫌 󱫔 󱎬 󱫒 󰀦 󰙚 󱫞 󰀄 󱅞 󰍩 
 var icon_solid = map[string]string{
 	"on":      "󱎫",
@@ -123,3 +166,34 @@ var bar_ascii = map[string]string{
 	"todo": "-",
 	"stop": " ",
 }
+
+// the leading cell of a smooth bar moves in eighths of a cell
+var bar_smooth = map[string]string{
+	"done": "█",
+	"todo": " ",
+	"stop": " ",
+	"mode": barModeSmooth,
+}
+
+// single glyph that fills from the bottom, for tight status bars
+var bar_vertical = map[string]string{
+	"done": "█",
+	"todo": " ",
+	"stop": " ",
+	"mode": barModeVertical,
+}
+
+// braille cells fill column by column, eight dots per cell
+var bar_braille = map[string]string{
+	"done": "⣿",
+	"todo": "⠀",
+	"stop": " ",
+	"mode": barModeBraille,
+}
+
+// partially filled cells for each eighth of progress, the full cell is the style's done character
+var barPartials = map[string][]string{
+	barModeSmooth:   {"", "▏", "▎", "▍", "▌", "▋", "▊", "▉"},
+	barModeBraille:  {"", "⡀", "⡄", "⡆", "⡇", "⣇", "⣧", "⣷"},
+	barModeVertical: {" ", "▁", "▂", "▃", "▄", "▅", "▆", "▇"},
+}
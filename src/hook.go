@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// timer transitions user commands can be attached to in the hooks section of config.json
+const (
+	hookStart       = "start"
+	hookStop        = "stop"
+	hookPause       = "pause"
+	hookResume      = "resume"
+	hookAlert       = "alert"
+	hookIntervalEnd = "interval-end"
+	hookBreakStart  = "break-start"
+	hookBreakEnd    = "break-end"
+	hookRestart     = "restart"
+	hookTaskChange  = "task-change"
+)
+
+var hookNames = []string{hookStart, hookStop, hookPause, hookResume, hookAlert, hookIntervalEnd,
+	hookBreakStart, hookBreakEnd, hookRestart, hookTaskChange}
+
+const (
+	hookTimeout   = 10 * time.Second // default time a hook may run before it is killed
+	hookWaitDelay = 1 * time.Second  // time left to a killed hook to close its output
+)
+
+// hooks of long running processes are handed to a single worker so they run in order without
+// holding up the daemon or the inline timer, nil when hooks run before the command returns
+var hookQueue chan []HookRun
+
+// commands of an event with the environment describing the timer when it happened
+type HookRun struct {
+	Event    string
+	Commands []string
+	Env      []string
+	Timeout  time.Duration
+	Debug    *History
+}
+
+// run hooks in the background for the rest of the process
+func StartHookWorker() {
+	hookQueue = make(chan []HookRun, 64)
+	go func() {
+		for runs := range hookQueue {
+			for _, run := range runs {
+				run.Run()
+			}
+		}
+	}()
+}
+
+// queue the hooks of an event, they run once the state lock is released
+func (t *Task) QueueHook(event string) {
+	commands := t.Config.Hooks[event]
+	if len(commands) == 0 || t.Hooks == nil {
+		return
+	}
+	timeout := hookTimeout
+	if t.Config.HookTimeout > 0 {
+		timeout = time.Duration(t.Config.HookTimeout) * time.Second
+	}
+	*t.Hooks = append(*t.Hooks, HookRun{
+		Event:    event,
+		Commands: commands,
+		Env:      t.HookEnv(event),
+		Timeout:  timeout,
+		Debug:    t.State.Debug,
+	})
+}
+
+// run the queued hooks, or hand them to the worker
+func (t *Task) RunHooks() {
+	runs := *t.Hooks
+	*t.Hooks = nil
+	if len(runs) == 0 {
+		return
+	}
+	if hookQueue != nil {
+		hookQueue <- runs
+		return
+	}
+	for _, run := range runs {
+		run.Run()
+	}
+}
+
+// environment variables describing the timer, durations in seconds
+func (t *Task) HookEnv(event string) []string {
+	status := t.GetStatusDetails().(TimerStatus)
+	return []string{
+		"TIMER_EVENT=" + event,
+		"TIMER_NAME=" + status.Name,
+		"TIMER_PHASE=" + status.Phase,
+		"TIMER_STATE=" + status.State,
+		"TIMER_TASK=" + status.Task,
+		fmt.Sprintf("TIMER_INTERVAL=%d", seconds(t.State.GetInterval())),
+		fmt.Sprintf("TIMER_BREAK=%d", seconds(t.State.GetBreak())),
+		fmt.Sprintf("TIMER_REMAINING=%d", status.Remaining),
+		fmt.Sprintf("TIMER_ELAPSED=%d", status.Elapsed),
+		fmt.Sprintf("TIMER_COUNT=%d", status.Count),
+		fmt.Sprintf("TIMER_CYCLE=%d", status.Cycle),
+		"TIMER_ROUTINE=" + status.Routine,
+	}
+}
+
+// run each command in order with sh, a failing or timed out command does not stop the next one;
+// failures are written to the hook log with the exit status and stderr of the command
+func (h HookRun) Run() {
+	for _, command := range h.Commands {
+		ctx, cancel := context.WithTimeout(context.Background(), h.Timeout)
+		var stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, "sh", "-c", command)
+		cmd.Env = append(os.Environ(), h.Env...)
+		cmd.Stderr = &stderr
+		cmd.WaitDelay = hookWaitDelay
+		err := cmd.Run()
+		if ctx.Err() != nil {
+			err = fmt.Errorf("timed out after %v", h.Timeout)
+		}
+		cancel()
+		output := strings.TrimSpace(stderr.String())
+		if err != nil {
+			h.Debug.Print("hook", h.Event, command, err)
+			h.logFailure(command, err, output)
+		}
+		if output != "" {
+			h.Debug.Print("hook", h.Event, command, "stderr:", output)
+		}
+	}
+}
+
+// append a failed command to the hook log, stderr follows indented on the next lines
+func (h HookRun) logFailure(command string, err error, stderr string) {
+	file, fileErr := ReturnLogFile(HookFile)
+	if fileErr != nil {
+		h.Debug.Print("logFailure()", fileErr)
+		return
+	}
+	defer file.Close()
+	entry := fmt.Sprintf("%v\t%v\t%q\t%v\n", time.Now().Format(time.RFC3339), h.Event, command, err)
+	if stderr != "" {
+		entry += "\t" + strings.ReplaceAll(stderr, "\n", "\n\t") + "\n"
+	}
+	_, fileErr = file.WriteString(entry)
+	if fileErr != nil {
+		h.Debug.Print("logFailure()", fileErr)
+	}
+}
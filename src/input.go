@@ -1,9 +1,11 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -12,14 +14,31 @@ var (
 	programName  = "terminalTimer"
 	zeroDuration = time.Duration(0 * time.Minute)
 	programHelp  bool
+	timerName    string // selected timer, empty for the default timer
+	renderAll    bool
+	renderFormat string // status line template, overrides the configured format
+	renderOutput string // machine readable output mode: waybar, i3bar or json
+	renderColor  string // color output mode, overrides the configured color mode
 
-	setTimer time.Duration
-	setBreak time.Duration
-	setAlert time.Duration
+	setTimer TimeValue // duration or wall clock time
+	setBreak TimeValue
+	setAlert AlertValue // comma separated thresholds
+	setLong  time.Duration
+	setCycle int
+
+	adjustElapsed time.Duration
+	startUntil    TimeValue // wall clock time the started interval runs until
+	watchTarget   time.Duration
+
+	waitFor     string // comma separated events the wait command blocks on, empty for any
+	waitTimeout time.Duration
+
+	statusJSON  bool // print status or info as a json line
+	statusQuiet bool // print nothing, exit with the code of the timer phase
 
 	styleWidth int
-	styleBar   int
-	styleIcon  int
+	styleBar   string
+	styleIcon  string
 
 	toggleProgress bool
 	toggleBell     bool
@@ -30,6 +49,11 @@ var (
 	toggleTmux     bool
 	toggleRestart  bool
 	toggleReverse  bool
+	toggleEnd      bool
+
+	exportFormat string
+	exportSince  string
+	exportUntil  string
 )
 
 func ValidateFlags() {
@@ -37,30 +61,46 @@ func ValidateFlags() {
 	programCmd := flag.NewFlagSet(programName, flag.ExitOnError)
 	programCmd.BoolVar(&programHelp, "help", false, UsageString["help"])
 	programCmd.BoolVar(&programHelp, "h", false, UsageString["help"])
+	programCmd.BoolVar(&renderAll, "all", false, UsageString["all"])
+	programCmd.BoolVar(&renderAll, "A", false, UsageString["all"])
+	AddNameFlag(programCmd)
+	AddFormatFlag(programCmd)
+	AddOutputFlag(programCmd)
+	AddColorFlag(programCmd)
 
 	programCmd.Usage = func() {
 		writer := flag.CommandLine.Output()
 		fmt.Fprintf(writer, "%s\n\r", UsageString["programCmd"])
-		f := programCmd.Lookup("help")
-		fmt.Printf("  -%v, -%v\n", Shorthand[f.Name], f.Name)
+		order := []string{"help", "name", "all", "format", "output", "color"}
+		for _, name := range order {
+			f := programCmd.Lookup(name)
+			fmt.Printf("  -%v, -%v\n", Shorthand[f.Name], f.Name)
+			fmt.Printf("\t%s\n", f.Usage)
+		}
 		fmt.Printf("\n")
 	}
 
 	taskCmd := flag.NewFlagSet(programName+" task", flag.ExitOnError)
 	taskString := taskCmd.String("task", "", UsageString["task"])
+	AddNameFlag(taskCmd)
 
 	setCmd := flag.NewFlagSet(programName+" set", flag.ExitOnError)
-	setCmd.DurationVar(&setTimer, "timer", zeroDuration, UsageString["setTimer"])
-	setCmd.DurationVar(&setTimer, "t", zeroDuration, UsageString["setTimer"])
-	setCmd.DurationVar(&setBreak, "break", zeroDuration, UsageString["setBreak"])
-	setCmd.DurationVar(&setBreak, "k", zeroDuration, UsageString["setBreak"])
-	setCmd.DurationVar(&setAlert, "alert", zeroDuration, UsageString["setAlert"])
-	setCmd.DurationVar(&setAlert, "a", zeroDuration, UsageString["setAlert"])
+	AddNameFlag(setCmd)
+	setCmd.Var(&setTimer, "timer", UsageString["setTimer"])
+	setCmd.Var(&setTimer, "t", UsageString["setTimer"])
+	setCmd.Var(&setBreak, "break", UsageString["setBreak"])
+	setCmd.Var(&setBreak, "k", UsageString["setBreak"])
+	setCmd.Var(&setAlert, "alert", UsageString["setAlert"])
+	setCmd.Var(&setAlert, "a", UsageString["setAlert"])
+	setCmd.DurationVar(&setLong, "longbreak", zeroDuration, UsageString["setLong"])
+	setCmd.DurationVar(&setLong, "L", zeroDuration, UsageString["setLong"])
+	setCmd.IntVar(&setCycle, "cycle", -1, UsageString["setCycle"])
+	setCmd.IntVar(&setCycle, "C", -1, UsageString["setCycle"])
 
 	setCmd.Usage = func() {
 		writer := flag.CommandLine.Output()
 		fmt.Fprintf(writer, "%s\n\r", UsageString["setCmd"])
-		order := []string{"timer", "break", "alert"}
+		order := []string{"timer", "break", "alert", "longbreak", "cycle", "name"}
 		for _, name := range order {
 			f := setCmd.Lookup(name)
 			fmt.Printf("  -%v, -%v\n", Shorthand[f.Name], f.Name)
@@ -69,13 +109,30 @@ func ValidateFlags() {
 		fmt.Printf("\n")
 	}
 
+	adjustCmd := flag.NewFlagSet(programName+" adjust", flag.ExitOnError)
+	adjustCmd.DurationVar(&adjustElapsed, "elapsed", -1, UsageString["adjustElapsed"])
+	adjustCmd.DurationVar(&adjustElapsed, "e", -1, UsageString["adjustElapsed"])
+	AddNameFlag(adjustCmd)
+
+	adjustCmd.Usage = func() {
+		writer := flag.CommandLine.Output()
+		fmt.Fprintf(writer, "%s\n\r", UsageString["adjustCmd"])
+		order := []string{"elapsed", "name"}
+		for _, name := range order {
+			f := adjustCmd.Lookup(name)
+			fmt.Printf("  -%v, -%v\n", Shorthand[f.Name], f.Name)
+			fmt.Printf("\t%s\n", f.Usage)
+		}
+		fmt.Printf("\n")
+	}
+
 	styleCmd := flag.NewFlagSet(programName+" style", flag.ExitOnError)
 	styleCmd.IntVar(&styleWidth, "width", 0, UsageString["styleWidth"])
 	styleCmd.IntVar(&styleWidth, "w", 0, UsageString["styleWidth"])
-	styleCmd.IntVar(&styleBar, "bar", 0, UsageString["styleBar"])
-	styleCmd.IntVar(&styleBar, "b", 0, UsageString["styleBar"])
-	styleCmd.IntVar(&styleIcon, "icon", 0, UsageString["styleIcon"])
-	styleCmd.IntVar(&styleIcon, "i", 0, UsageString["styleIcon"])
+	styleCmd.StringVar(&styleBar, "bar", "", UsageString["styleBar"])
+	styleCmd.StringVar(&styleBar, "b", "", UsageString["styleBar"])
+	styleCmd.StringVar(&styleIcon, "icon", "", UsageString["styleIcon"])
+	styleCmd.StringVar(&styleIcon, "i", "", UsageString["styleIcon"])
 
 	styleCmd.Usage = func() {
 		writer := flag.CommandLine.Output()
@@ -108,12 +165,14 @@ func ValidateFlags() {
 	toggleCmd.BoolVar(&toggleRestart, "r", false, UsageString["toggleRestart"])
 	toggleCmd.BoolVar(&toggleReverse, "reverse", false, UsageString["toggleReverse"])
 	toggleCmd.BoolVar(&toggleReverse, "v", false, UsageString["toggleReverse"])
+	toggleCmd.BoolVar(&toggleEnd, "end", false, UsageString["toggleEnd"])
+	toggleCmd.BoolVar(&toggleEnd, "e", false, UsageString["toggleEnd"])
 
 	toggleCmd.Usage = func() {
 		writer := flag.CommandLine.Output()
 		fmt.Fprintf(writer, "%s\n\r", UsageString["toggleCmd"])
 		order := []string{
-			"progress", "bell", "clock", "symbol", "percent", "restart", "reverse",
+			"progress", "bell", "clock", "symbol", "percent", "end", "restart", "reverse",
 			"notify", "tmux"}
 
 		for _, name := range order {
@@ -124,24 +183,45 @@ func ValidateFlags() {
 		fmt.Printf("\n")
 	}
 
-	// invoking with program name by itself will render static output and exit
-	if args == 1 {
-		t, _ := InitializeTimer()
-		t.GetTime()
-		t.Render()
-		os.Exit(0)
+	exportCmd := flag.NewFlagSet(programName+" export", flag.ExitOnError)
+	exportCmd.StringVar(&exportFormat, "format", "csv", UsageString["exportFormat"])
+	exportCmd.StringVar(&exportFormat, "f", "csv", UsageString["exportFormat"])
+	exportCmd.StringVar(&exportSince, "since", "", UsageString["exportSince"])
+	exportCmd.StringVar(&exportSince, "s", "", UsageString["exportSince"])
+	exportCmd.StringVar(&exportUntil, "until", "", UsageString["exportUntil"])
+	exportCmd.StringVar(&exportUntil, "u", "", UsageString["exportUntil"])
+	AddNameFlag(exportCmd)
+
+	exportCmd.Usage = func() {
+		writer := flag.CommandLine.Output()
+		fmt.Fprintf(writer, "%s\n\r", UsageString["exportCmd"])
+		order := []string{"format", "since", "until", "name"}
+		for _, name := range order {
+			f := exportCmd.Lookup(name)
+			fmt.Printf("  -%v, -%v\n", Shorthand[f.Name], f.Name)
+			fmt.Printf("\t%s\n", f.Usage)
+		}
+		fmt.Printf("\n")
 	}
 
-	// if program is invoked with one argument, and it is --help
-	if args == 2 {
+	// invoking with program name and only flags will render static output and exit, or show help
+	if args == 1 || strings.HasPrefix(os.Args[1], "-") {
 		programCmd.Parse(os.Args[1:])
 		if programHelp {
 			PrintBasicUsage()
+			programCmd.Usage()
 			setCmd.Usage()
+			adjustCmd.Usage()
 			styleCmd.Usage()
 			toggleCmd.Usage()
+			exportCmd.Usage()
 			os.Exit(0)
 		}
+		ValidateTimerName()
+		ValidateOutput()
+		ValidateColor()
+		HandleRender()
+		os.Exit(0)
 	}
 
 	// check if first argument is a non-flag, and matches one of the listed strings
@@ -151,7 +231,7 @@ func ValidateFlags() {
 	case "task":
 		HandleTaskCmd(taskCmd, taskString)
 	case "start":
-		HandleProgramCmd("start")
+		HandleStartCmd()
 	case "stop":
 		HandleProgramCmd("stop")
 	case "pause":
@@ -160,35 +240,134 @@ func ValidateFlags() {
 		HandleProgramCmd("resume")
 	case "break":
 		HandleProgramCmd("break")
+	case "stopwatch":
+		HandleStopwatchCmd()
+	case "lap":
+		HandleProgramCmd("lap")
+	case "wait":
+		HandleWaitCmd()
+	case "skip":
+		HandleProgramCmd("skip")
+	case "finish":
+		HandleProgramCmd("finish")
+	case "reset":
+		HandleProgramCmd("reset")
+	case "extend":
+		HandleExtendCmd("extend")
+	case "shorten":
+		HandleExtendCmd("shorten")
+	case "snooze":
+		HandleSnoozeCmd()
+	case "adjust":
+		HandleAdjustCmd(adjustCmd, &adjustElapsed)
+	case "routine":
+		HandleRoutineCmd()
 	case "run":
-		HandleProgramCmd("run")
+		HandleRunCmd()
 		// HandleProgramRun()
+	case "list":
+		HandleList()
+	case "report":
+		HandleReport()
+	case "export":
+		HandleExportCmd(exportCmd, &exportFormat, &exportSince, &exportUntil)
 	case "info":
 		HandleInfo()
 	case "status":
 		HandleStatus()
 	case "clean":
 		HandleClean()
+	case "daemon":
+		HandleDaemonCmd()
 	case "set":
-		HandleSetCmd(setCmd, &setTimer, &setBreak, &setAlert)
+		HandleSetCmd(setCmd, &setTimer, &setBreak, &setAlert, &setLong, &setCycle)
 	case "style":
 		HandleStyleCmd(styleCmd, &styleWidth, &styleBar, &styleIcon)
 	case "toggle":
 		HandleToggleCmd(toggleCmd, &toggleProgress, &toggleBell, &toggleClock, &toggleSymbol,
-			&toggleNotify, &togglePercent, &toggleRestart, &toggleReverse, &toggleTmux)
+			&toggleNotify, &togglePercent, &toggleRestart, &toggleReverse, &toggleTmux, &toggleEnd)
 	case "help":
 		PrintBasicUsage()
+		programCmd.Usage()
 		setCmd.Usage()
+		adjustCmd.Usage()
 		styleCmd.Usage()
 		toggleCmd.Usage()
+		exportCmd.Usage()
 	default:
 		PrintBasicUsage()
 	}
 	os.Exit(0)
 }
 
+// register the -name flag selecting which timer a command acts on
+func AddNameFlag(cmd *flag.FlagSet) {
+	cmd.StringVar(&timerName, "name", "", UsageString["name"])
+	cmd.StringVar(&timerName, "N", "", UsageString["name"])
+}
+
+// register the -format flag overriding the status line template
+func AddFormatFlag(cmd *flag.FlagSet) {
+	cmd.StringVar(&renderFormat, "format", "", UsageString["format"])
+	cmd.StringVar(&renderFormat, "f", "", UsageString["format"])
+}
+
+// register the -output flag selecting a machine readable output mode
+func AddOutputFlag(cmd *flag.FlagSet) {
+	cmd.StringVar(&renderOutput, "output", "", UsageString["output"])
+	cmd.StringVar(&renderOutput, "o", "", UsageString["output"])
+}
+
+// exit if the mode passed with -output is unknown
+func ValidateOutput() {
+	if renderOutput != "" && !outputModes[renderOutput] {
+		fmt.Printf("'%v' invalid: output modes are waybar, i3bar and json\n", renderOutput)
+		os.Exit(2)
+	}
+}
+
+// register the -color flag selecting how theme colors are written
+func AddColorFlag(cmd *flag.FlagSet) {
+	cmd.StringVar(&renderColor, "color", "", UsageString["color"])
+	cmd.StringVar(&renderColor, "c", "", UsageString["color"])
+}
+
+// exit if the mode passed with -color is unknown
+func ValidateColor() {
+	switch renderColor {
+	case "", colorAuto, colorANSI, colorTmux, colorNone:
+		return
+	}
+	fmt.Printf("'%v' invalid: color modes are auto, ansi, tmux and none\n", renderColor)
+	os.Exit(2)
+}
+
+// flag set for commands that only accept the timer name
+func NewTimerCmd(command string) *flag.FlagSet {
+	cmd := flag.NewFlagSet(programName+" "+command, flag.ExitOnError)
+	AddNameFlag(cmd)
+	return cmd
+}
+
+// exit if the name passed with -name can not be used as a timer name
+func ValidateTimerName() {
+	if timerName != "" && !ValidTimerName(timerName) {
+		fmt.Printf("'%v' invalid: timer names may contain letters, digits, '-', '_' and '.'\n", timerName)
+		os.Exit(2)
+	}
+}
+
+// exit if the timer selected with -name has no state yet
+func ValidateTimerExists() {
+	if !TimerExists(timerName) {
+		fmt.Printf("%v: no such timer: %v\n", programName, timerName)
+		os.Exit(1)
+	}
+}
+
 func ValidateTaskCmd(taskCmd *flag.FlagSet, task *string) {
 	taskCmd.Parse(os.Args[2:])
+	ValidateTimerName()
 	if len(taskCmd.Args()) == 0 {
 		taskCmd.Usage()
 		os.Exit(0)
@@ -197,34 +376,368 @@ func ValidateTaskCmd(taskCmd *flag.FlagSet, task *string) {
 
 func HandleTaskCmd(taskCmd *flag.FlagSet, taskStr *string) {
 	ValidateTaskCmd(taskCmd, taskStr)
+	HandleRequest(Request{Command: "task", Name: timerName, Args: taskCmd.Args()})
+}
+
+// render the selected timer, or every timer with -all
+func HandleRender() {
+	if !renderAll {
+		ValidateTimerExists()
+		t, _ := InitializeTimer()
+		t.GetTime()
+		RenderOutput(&t)
+		return
+	}
+	names, err := TimerNames()
+	if err != nil {
+		return
+	}
+	for k, name := range names {
+		t, _ := InitializeNamedTimer(name)
+		t.GetTime()
+		if renderOutput != "" { // one json line per timer
+			RenderOutput(&t)
+			continue
+		}
+		if k > 0 {
+			fmt.Printf("%v", timerSeparator)
+		}
+		if name != DefaultTimer {
+			fmt.Printf("%v: ", name)
+		}
+		t.Render()
+	}
+}
+
+// print the timer as text, or as a json line when -output is set
+func RenderOutput(t *Task) {
+	if renderOutput == "" {
+		t.Render()
+		return
+	}
+	line, err := t.Output(renderOutput)
+	if err != nil {
+		t.State.Debug.Print(t.State.Debug.Trace(), err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s\n", line)
+}
+
+// print every timer with its phase and remaining time
+func HandleList() {
+	names, err := TimerNames()
+	if err != nil {
+		fmt.Printf("%v list error: %v\n", programName, err)
+		os.Exit(1)
+	}
+	for _, name := range names {
+		t, _ := InitializeNamedTimer(name)
+		t.GetTime()
+		fmt.Printf("%-16v %-14v %9v  %v\n", name, stateString[t.State.GetPhase()],
+			t.FormatTime(t.State.GetRemaining()), t.State.GetTask())
+	}
+}
+
+// summarize recorded sessions of every timer, or of the timer selected with -name
+func HandleReport() {
+	NewTimerCmd("report").Parse(os.Args[2:])
+	ValidateTimerName()
+	sessions, err := ReadSessions()
+	if err != nil {
+		fmt.Printf("%v report error: %v\n", programName, err)
+		os.Exit(1)
+	}
+	sessions = FilterSessions(sessions, timerName, time.Time{}, time.Time{})
+	fmt.Printf("%v", BuildReport(sessions, time.Now()))
+}
+
+// write recorded sessions to stdout as csv, json or ics
+func HandleExportCmd(exportCmd *flag.FlagSet, format, since, until *string) {
+	exportCmd.Parse(os.Args[2:])
+	ValidateTimerName()
+	export, ok := exportFormats[*format]
+	if !ok || len(exportCmd.Args()) > 0 {
+		exportCmd.Usage()
+		os.Exit(2)
+	}
+	from, err := ParseExportDate(*since, false)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	to, err := ParseExportDate(*until, true)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	sessions, err := ReadSessions()
+	if err != nil {
+		fmt.Printf("%v export error: %v\n", programName, err)
+		os.Exit(1)
+	}
+	err = export(os.Stdout, FilterSessions(sessions, timerName, from, to))
+	if err != nil {
+		fmt.Printf("%v export error: %v\n", programName, err)
+		os.Exit(1)
+	}
+}
+
+// display the timer inline, optionally with a custom format
+func HandleRunCmd() {
+	runCmd := NewTimerCmd("run")
+	AddFormatFlag(runCmd)
+	AddOutputFlag(runCmd)
+	AddColorFlag(runCmd)
+	runCmd.Parse(os.Args[2:])
+	ValidateTimerName()
+	ValidateOutput()
+	ValidateColor()
 	t, _ := InitializeTimer()
-	cmd := t.Display["task"]
-	str := strings.Join(taskCmd.Args(), " ")
-	cmd(str)
-	t.Message("changed task to")
-	t.State.Save()
+	StartHookWorker() // hooks fired by the running timer must not hold up its display
+	EnableNotificationActions()
+	if renderOutput != "" {
+		err := t.RunStream(renderOutput)
+		if err != nil {
+			fmt.Printf("%v run error: %v\n", programName, err)
+			os.Exit(1)
+		}
+		return
+	}
+	t.RunInline()
 }
 
 func HandleProgramCmd(command string) {
+	NewTimerCmd(command).Parse(os.Args[2:])
+	ValidateTimerName()
+	HandleRequest(Request{Command: command, Name: timerName})
+}
+
+// send a request to the daemon, or run it directly, and print its output
+func HandleRequest(r Request) {
+	output, err := Dispatch(r)
+	fmt.Print(output)
+	if err != nil {
+		fmt.Printf("%v: %v\n", programName, err)
+		os.Exit(1)
+	}
+}
+
+// run the background daemon until it is interrupted or sent shutdown
+func HandleDaemonCmd() {
+	daemonCmd := flag.NewFlagSet(programName+" daemon", flag.ExitOnError)
+	daemonCmd.Parse(os.Args[2:])
+	switch daemonCmd.Arg(0) {
+	case "":
+		err := RunDaemon()
+		if err != nil {
+			fmt.Printf("%v daemon error: %v\n", programName, err)
+			os.Exit(1)
+		}
+	case "stop":
+		_, err := (Request{Command: "shutdown"}).Send()
+		if err != nil {
+			fmt.Printf("%v daemon error: %v\n", programName, err)
+			os.Exit(1)
+		}
+	case "status":
+		path, _ := SocketPath()
+		_, err := (Request{Command: "ping"}).Send()
+		if err != nil {
+			fmt.Printf("%v daemon not running\n", programName)
+			os.Exit(1)
+		}
+		fmt.Printf("%v daemon listening on %v\n", programName, path)
+	default:
+		fmt.Printf("%v\n", UsageString["daemonCmd"])
+	}
+}
+
+// start the timer, -until runs the interval until a wall clock time or for a duration
+func HandleStartCmd() {
+	startCmd := NewTimerCmd("start")
+	startCmd.Var(&startUntil, "until", UsageString["startUntil"])
+	startCmd.Var(&startUntil, "u", UsageString["startUntil"])
+	startCmd.Parse(os.Args[2:])
+	ValidateTimerName()
+	if !startUntil.IsSet() {
+		HandleRequest(Request{Command: "start", Name: timerName})
+		return
+	}
+	if startUntil.Until.IsZero() {
+		startUntil.Until = time.Now().Add(startUntil.Duration)
+	}
+	HandleRequest(Request{Command: "start", Name: timerName, Args: []string{"timer=" + startUntil.Arg()}})
+}
+
+// count up with no interval, -target sets a soft target for the progress bar
+func HandleStopwatchCmd() {
+	stopwatchCmd := NewTimerCmd("stopwatch")
+	stopwatchCmd.DurationVar(&watchTarget, "target", zeroDuration, UsageString["stopwatchTarget"])
+	stopwatchCmd.DurationVar(&watchTarget, "T", zeroDuration, UsageString["stopwatchTarget"])
+	stopwatchCmd.Parse(os.Args[2:])
+	ValidateTimerName()
+	if watchTarget < zeroDuration || stopwatchCmd.NArg() > 0 {
+		stopwatchCmd.Usage()
+		os.Exit(2)
+	}
+	HandleRequest(Request{Command: "stopwatch", Name: timerName, Args: []string{watchTarget.String()}})
+}
+
+// lengthen or cut short the running interval or break by the duration argument
+func HandleExtendCmd(command string) {
+	extendCmd := NewTimerCmd(command)
+	extendCmd.Parse(os.Args[2:])
+	ValidateTimerName()
+	if extendCmd.NArg() != 1 {
+		fmt.Printf("%v\n", UsageString[command+"Cmd"])
+		os.Exit(2)
+	}
+	d, err := time.ParseDuration(extendCmd.Arg(0))
+	if err != nil || d <= 0 {
+		fmt.Printf("'%v' invalid: %v accepts one positive duration, e.g. 5m\n", extendCmd.Arg(0), command)
+		os.Exit(2)
+	}
+	HandleRequest(Request{Command: command, Name: timerName, Args: []string{d.String()}})
+}
+
+// put off the next phase by the duration argument, or by snoozeStep
+func HandleSnoozeCmd() {
+	snoozeCmd := NewTimerCmd("snooze")
+	snoozeCmd.Parse(os.Args[2:])
+	ValidateTimerName()
+	d := snoozeStep
+	switch snoozeCmd.NArg() {
+	case 0:
+	case 1:
+		var err error
+		d, err = time.ParseDuration(snoozeCmd.Arg(0))
+		if err != nil || d <= 0 {
+			fmt.Printf("'%v' invalid: snooze accepts one positive duration, e.g. 10m\n", snoozeCmd.Arg(0))
+			os.Exit(2)
+		}
+	default:
+		fmt.Printf("%v\n", UsageString["snoozeCmd"])
+		os.Exit(2)
+	}
+	HandleRequest(Request{Command: "snooze", Name: timerName, Args: []string{d.String()}})
+}
+
+func HandleAdjustCmd(adjustCmd *flag.FlagSet, elapsed *time.Duration) {
+	adjustCmd.Parse(os.Args[2:])
+	ValidateTimerName()
+	if *elapsed < zeroDuration || adjustCmd.NArg() > 0 {
+		adjustCmd.Usage()
+		os.Exit(0)
+	}
+	HandleRequest(Request{Command: "elapsed", Name: timerName, Args: []string{elapsed.String()}})
+}
+
+// start the routine named by the first argument, list routines if none is given
+func HandleRoutineCmd() {
+	routineCmd := NewTimerCmd("routine")
+	routineCmd.Parse(os.Args[2:])
+	ValidateTimerName()
 	t, _ := InitializeTimer()
-	cmd := t.ExecuteCommand(command)
-	if cmd == nil {
-		t.State.Debug.Print("invalid command:", command)
+	if len(routineCmd.Args()) == 0 {
+		fmt.Printf("%v\n", UsageString["routineCmd"])
+		for _, name := range t.Config.RoutineNames() {
+			fmt.Printf("  %v\n", name)
+			for _, p := range t.Config.Routines[name] {
+				fmt.Printf("\t%-6v %-8v %v\n", p.Kind, p.Duration, p.Name)
+			}
+		}
 		return
 	}
-	cmd()
+	HandleRequest(Request{Command: "routine", Name: timerName, Args: routineCmd.Args()})
+}
+
+// block until a timer event and print it; with a single event the exit code is 0, with several it
+// tells which one happened, and it is exitTimeout when -timeout passes first
+func HandleWaitCmd() {
+	waitCmd := NewTimerCmd("wait")
+	waitCmd.StringVar(&waitFor, "for", "", UsageString["waitFor"])
+	waitCmd.StringVar(&waitFor, "f", "", UsageString["waitFor"])
+	waitCmd.DurationVar(&waitTimeout, "timeout", zeroDuration, UsageString["waitTimeout"])
+	waitCmd.DurationVar(&waitTimeout, "t", zeroDuration, UsageString["waitTimeout"])
+	waitCmd.Parse(os.Args[2:])
+	ValidateTimerName()
+	events := waitOrder
+	if waitFor != "" {
+		events = strings.Split(waitFor, ",")
+	}
+	for _, event := range events {
+		if _, ok := waitEvents[event]; !ok {
+			fmt.Printf("'%v' invalid: wait events are %v\n", event, strings.Join(waitOrder, ", "))
+			os.Exit(2)
+		}
+	}
+	if waitTimeout < zeroDuration || waitCmd.NArg() > 0 {
+		waitCmd.Usage()
+		os.Exit(2)
+	}
+	ValidateTimerExists()
+	event := WaitEvent(timerName, events, waitTimeout)
+	if event == "" {
+		os.Exit(exitTimeout)
+	}
+	fmt.Printf("%v\n", event)
+	if len(events) == 1 {
+		os.Exit(0)
+	}
+	os.Exit(waitEvents[event])
+}
+
+// register the -json flag printing status or info as a json line
+func AddJSONFlag(cmd *flag.FlagSet) {
+	cmd.BoolVar(&statusJSON, "json", false, UsageString["json"])
+	cmd.BoolVar(&statusJSON, "j", false, UsageString["json"])
 }
 
 func HandleInfo() {
-	t, _ := InitializeTimer()
-	c := t.Info()
-	fmt.Printf(c)
+	infoCmd := NewTimerCmd("info")
+	AddJSONFlag(infoCmd)
+	infoCmd.Parse(os.Args[2:])
+	ValidateTimerName()
+	r := Request{Command: "info", Name: timerName}
+	if statusJSON {
+		r.Args = []string{"json"}
+	}
+	HandleRequest(r)
 }
 
+// print the timer status as text, json or a format template; -quiet prints nothing and exits with
+// the code of the phase instead
 func HandleStatus() {
-	t, _ := InitializeTimer()
-	c := t.GetState()
-	fmt.Printf(c)
+	statusCmd := NewTimerCmd("status")
+	AddJSONFlag(statusCmd)
+	AddFormatFlag(statusCmd)
+	statusCmd.BoolVar(&statusQuiet, "quiet", false, UsageString["quiet"])
+	statusCmd.BoolVar(&statusQuiet, "q", false, UsageString["quiet"])
+	statusCmd.Parse(os.Args[2:])
+	ValidateTimerName()
+	r := Request{Command: "status", Name: timerName}
+	switch {
+	case statusQuiet || statusJSON:
+		r.Args = []string{"json"}
+	case renderFormat != "":
+		r.Args = []string{"format=" + renderFormat}
+	}
+	if !statusQuiet {
+		HandleRequest(r)
+		return
+	}
+	output, err := Dispatch(r)
+	if err != nil {
+		fmt.Printf("%v: %v\n", programName, err)
+		os.Exit(1)
+	}
+	var status TimerStatus
+	err = json.Unmarshal([]byte(output), &status)
+	if err != nil {
+		fmt.Printf("%v: %v\n", programName, err)
+		os.Exit(1)
+	}
+	os.Exit(phaseExit[status.Phase])
 }
 
 func HandleClean() {
@@ -237,13 +750,18 @@ func HandleClean() {
 }
 
 // handle negative durations being passed
-func ValidateSetCmd(setCmd *flag.FlagSet, timeInterval, breakInterval, alertInterval *time.Duration) {
+func ValidateSetCmd(setCmd *flag.FlagSet, timeInterval, breakInterval *TimeValue, longInterval *time.Duration, cycle *int) {
 	setCmd.Parse(os.Args[2:])
+	ValidateTimerName()
 	if len(os.Args) < 3 {
 		setCmd.Usage()
 		os.Exit(0)
 	}
-	if *timeInterval < zeroDuration || *breakInterval < zeroDuration || *alertInterval < zeroDuration {
+	if timeInterval.Duration < zeroDuration || breakInterval.Duration < zeroDuration || *longInterval < zeroDuration {
+		setCmd.Usage()
+		os.Exit(0)
+	}
+	if *cycle < -1 { // -1 is the unset default, 0 disables long breaks
 		setCmd.Usage()
 		os.Exit(0)
 	}
@@ -254,32 +772,35 @@ func ValidateSetCmd(setCmd *flag.FlagSet, timeInterval, breakInterval, alertInte
 		os.Exit(0)
 	}
 }
-func HandleSetCmd(setCmd *flag.FlagSet, timeInterval, breakInterval, alertInterval *time.Duration) {
+func HandleSetCmd(setCmd *flag.FlagSet, timeInterval, breakInterval *TimeValue, alertInterval *AlertValue, longInterval *time.Duration, cycle *int) {
 	setCmd.Parse(os.Args[2:])
-	ValidateSetCmd(setCmd, timeInterval, breakInterval, alertInterval)
+	ValidateSetCmd(setCmd, timeInterval, breakInterval, longInterval, cycle)
 
-	t, _ := InitializeTimer()
-	if *timeInterval > zeroDuration {
-		cmd := t.SetDuration("timer")
-		cmd(*timeInterval)
+	var values []string
+	if timeInterval.IsSet() {
+		values = append(values, "timer="+timeInterval.Arg())
+	}
+	if breakInterval.IsSet() {
+		values = append(values, "break="+breakInterval.Arg())
+	}
+	if alertInterval.IsSet() {
+		values = append(values, "alert="+alertInterval.Arg())
 	}
-	if *breakInterval > zeroDuration {
-		cmd := t.SetDuration("break")
-		cmd(*breakInterval)
+	if *longInterval > zeroDuration {
+		values = append(values, "longbreak="+longInterval.String())
 	}
-	if *alertInterval > zeroDuration {
-		cmd := t.SetDuration("alert")
-		cmd(*alertInterval)
+	if *cycle >= 0 {
+		values = append(values, "cycle="+strconv.Itoa(*cycle))
 	}
-	t.State.Save()
+	HandleRequest(Request{Command: "set", Name: timerName, Args: values})
 }
 
-func ValidateStyleCmd(styleCmd *flag.FlagSet, width, bar, icon *int) {
+func ValidateStyleCmd(styleCmd *flag.FlagSet, width *int, bar, icon *string) {
 	if len(os.Args) < 3 {
 		styleCmd.Usage()
 		os.Exit(0)
 	}
-	if *width < 0 || *bar < 0 || *icon < 0 {
+	if *width < 0 || strings.HasPrefix(*bar, "-") || strings.HasPrefix(*icon, "-") {
 		styleCmd.Usage()
 		os.Exit(0)
 	}
@@ -291,135 +812,220 @@ func ValidateStyleCmd(styleCmd *flag.FlagSet, width, bar, icon *int) {
 	}
 }
 
-func HandleStyleCmd(styleCmd *flag.FlagSet, width, bar, icon *int) {
+// bar and icon accept the number of a built-in style or the name of a built-in or custom style
+func HandleStyleCmd(styleCmd *flag.FlagSet, width *int, bar, icon *string) {
 	styleCmd.Parse(os.Args[2:])
 	ValidateStyleCmd(styleCmd, width, bar, icon)
 
 	t, _ := InitializeTimer()
-	if *width != 0 {
-		cmd := t.SetOption("size")
-		cmd(*width)
+	err := t.UpdateConfig(func() error {
+		return t.SetStyle(*width, *bar, *icon)
+	})
+	if err != nil {
+		fmt.Printf("%v style error: %v\n", programName, err)
+		os.Exit(1)
 	}
-	if *bar > 0 {
-		cmd := t.SetOption("style")
-		cmd(*bar)
+}
+
+// set the bar width, bar style and icon set that are not empty
+func (t *Task) SetStyle(width int, bar, icon string) error {
+	if width != 0 {
+		cmd := t.SetOption("size")
+		cmd(width)
 	}
-	if *icon > 0 {
-		cmd := t.SetOption("symbol")
-		cmd(*icon)
+	if bar != "" {
+		if n, err := strconv.Atoi(bar); err == nil {
+			cmd := t.SetOption("style")
+			cmd(n)
+		} else if _, ok := t.Config.GetBarStyle(bar); ok {
+			cmd := t.SetString("barstyle")
+			cmd(bar)
+		} else {
+			return fmt.Errorf("'%v' invalid: bar styles are %v", bar, strings.Join(t.Config.BarStyleNames(), ", "))
+		}
 	}
-	err := t.Config.Save()
-	if err != nil {
-		t.State.Debug.Print(t.State.Debug.Trace(), err)
+	if icon != "" {
+		if n, err := strconv.Atoi(icon); err == nil {
+			cmd := t.SetOption("symbol")
+			cmd(n)
+		} else if _, ok := t.Config.GetIconSet(icon); ok {
+			cmd := t.SetString("iconset")
+			cmd(icon)
+		} else {
+			return fmt.Errorf("'%v' invalid: icon sets are %v", icon, strings.Join(t.Config.IconSetNames(), ", "))
+		}
 	}
+	return nil
 }
 
-func HandleToggleCmd(toggleCmd *flag.FlagSet, progress, bell, clock, symbol, notify, percent, restart, reverse, tmux *bool) {
+func HandleToggleCmd(toggleCmd *flag.FlagSet, progress, bell, clock, symbol, notify, percent, restart, reverse, tmux, end *bool) {
 	toggleCmd.Parse(os.Args[2:])
 	var cmd []func(bool)
-	var config []bool
+	var config []func() bool // current values, read after the config is reloaded
 	t, _ := InitializeTimer()
 	if *progress {
 		cmd = append(cmd, t.ToggleOption("progress"))
-		config = append(config, t.Config.HideBar)
+		config = append(config, func() bool { return t.Config.HideBar })
 	}
 	if *bell {
 		cmd = append(cmd, t.ToggleOption("bell"))
-		config = append(config, t.Config.Bell)
+		config = append(config, func() bool { return t.Config.Bell })
 	}
 	if *clock {
 		cmd = append(cmd, t.ToggleOption("clock"))
-		config = append(config, t.Config.HideTime)
+		config = append(config, func() bool { return t.Config.HideTime })
 	}
 	if *symbol {
 		cmd = append(cmd, t.ToggleOption("symbol"))
-		config = append(config, t.Config.HideIcon)
+		config = append(config, func() bool { return t.Config.HideIcon })
 	}
 	if *notify {
 		cmd = append(cmd, t.ToggleOption("notify"))
-		config = append(config, t.Config.Notify)
+		config = append(config, func() bool { return t.Config.NotifierEnabled(notifierSend) })
 	}
 	if *percent {
 		cmd = append(cmd, t.ToggleOption("percent"))
-		config = append(config, t.Config.Percent)
+		config = append(config, func() bool { return t.Config.Percent })
 	}
 	if *restart {
 		cmd = append(cmd, t.ToggleOption("restart"))
-		config = append(config, t.Config.Restart)
+		config = append(config, func() bool { return t.Config.Restart })
 	}
 	if *reverse {
 		cmd = append(cmd, t.ToggleOption("reverse"))
-		config = append(config, t.Config.ReverseTime)
+		config = append(config, func() bool { return t.Config.ReverseTime })
 	}
 	if *tmux {
 		cmd = append(cmd, t.ToggleOption("tmux"))
-		config = append(config, t.Config.NotifyTmux)
+		config = append(config, func() bool { return t.Config.NotifierEnabled(notifierTmuxPopup) })
+	}
+	if *end {
+		cmd = append(cmd, t.ToggleOption("end"))
+		config = append(config, func() bool { return t.Config.ShowEnd })
 	}
 	if len(cmd) == 0 {
 		toggleCmd.Usage()
 		os.Exit(0)
 	}
-	for k, function := range cmd { // call function with the current config value flipped
-		function(!config[k])
-	}
-	err := t.Config.Save()
+	err := t.UpdateConfig(func() error {
+		for k, function := range cmd { // call function with the current config value flipped
+			function(!config[k]())
+		}
+		return nil
+	})
 	if err != nil {
-		t.State.Debug.Print(t.State.Debug.Trace(), err)
+		fmt.Printf("%v toggle error: %v\n", programName, err)
 		os.Exit(1)
 	}
 }
 
 var UsageString = map[string]string{
-	"programCmd":     "Usage of " + programName,
-	"setCmd":         "Usage of " + programName + " set (duration)",
-	"styleCmd":       "Usage of " + programName + " style (int)",
-	"toggleCmd":      "Usage of " + programName + " toggle",
-	"help":           "display full help",
-	"start":          "start timer",
-	"stop":           "stop timer",
-	"pause":          "pause timer",
-	"resume":         "start timer if paused",
-	"break":          "start break",
-	"run":            "display timer inline inside terminal",
-	"clean":          "delete timer log file",
-	"clear":          "clear the string for current task",
-	"status":         "return current timer status",
-	"info":           "return current timer interval values",
-	"setTimer":       "set timer interval",
-	"setBreak":       "set break interval",
-	"setAlert":       "set threshold to start alert",
-	"styleWidth":     "style progress bar width",
-	"styleBar":       "style progress bar appearance",
-	"styleIcon":      "style icon appearance",
-	"task":           "set the string for current task",
-	"toggleProgress": "turn progress bar on/off",
-	"toggleBell":     "turn terminal bell on/off",
-	"toggleClock":    "display time on/off",
-	"toggleSymbol":   "display symbol on/off",
-	"toggleNotify":   "turn timer notifications on/off for notify-send",
-	"togglePercent":  "display interval percentage on/off",
-	"toggleRestart":  "turn automatic timer restart on/off",
-	"toggleReverse":  "timer displays time descending/ascending",
-	"toggleTmux":     "turn timer notifications on/off for tmux",
+	"programCmd":      "Usage of " + programName + " (flags)",
+	"setCmd":          "Usage of " + programName + " set (duration)",
+	"styleCmd":        "Usage of " + programName + " style (int|name)",
+	"toggleCmd":       "Usage of " + programName + " toggle",
+	"help":            "display full help",
+	"name":            "select a timer by name, each named timer keeps its own state",
+	"all":             "render every timer",
+	"color":           "color output of the theme: auto, ansi, tmux or none",
+	"output":          "machine readable output for status bars: waybar, i3bar or json",
+	"format":          "status line template, e.g. '{icon} {task}[ ({cycle})] {bar}{time}'",
+	"list":            "list all timers with their status and remaining time",
+	"report":          "summarize recorded intervals per day, week and task",
+	"export":          "write recorded intervals and breaks as csv, json or ics",
+	"exportCmd":       "Usage of " + programName + " export",
+	"exportFormat":    "output format: csv, json or ics",
+	"exportSince":     "first day to export (YYYY-MM-DD)",
+	"exportUntil":     "last day to export (YYYY-MM-DD)",
+	"start":           "start timer",
+	"stop":            "stop timer",
+	"pause":           "pause timer",
+	"resume":          "start timer if paused",
+	"break":           "start break",
+	"run":             "display timer inline inside terminal",
+	"stopwatch":       "count up from zero with no interval, pause, resume and lap work as usual",
+	"stopwatchTarget": "soft target the progress bar fills up to, the stopwatch keeps running",
+	"lap":             "record a lap of the running stopwatch",
+	"skip":            "leave the running interval or break early and move to the next phase",
+	"finish":          "complete the running interval or break now",
+	"reset":           "start the running interval or break over from zero",
+	"extend":          "add time to the running interval or break",
+	"extendCmd":       "Usage of " + programName + " extend (duration)",
+	"shorten":         "remove time from the running interval or break",
+	"shortenCmd":      "Usage of " + programName + " shorten (duration)",
+	"snooze":          "extend the interval or break in progress by 5m, or run the break of a completed timer 5m more",
+	"snoozeCmd":       "Usage of " + programName + " snooze [duration]",
+	"adjust":          "change how much of the running interval or break has passed",
+	"adjustCmd":       "Usage of " + programName + " adjust",
+	"adjustElapsed":   "time already spent in the running interval or break",
+	"routine":         "start a routine of phases defined in config",
+	"routineCmd":      "Usage of " + programName + " routine (name), available routines:",
+	"clean":           "delete timer log file",
+	"daemon":          "run in the background, firing timer events on time and serving other commands",
+	"daemonCmd":       "Usage of " + programName + " daemon (stop|status)",
+	"clear":           "clear the string for current task",
+	"status":          "return current timer status, -quiet exits 0 running, 3 break, 4 paused, 5 break paused, 6 complete, 7 stopped",
+	"info":            "return current timer interval values",
+	"json":            "print as a single json line",
+	"wait":            "block until a timer event: alert, break, end, expired or stopped",
+	"waitFor":         "comma separated events to wait for, e.g. break or alert,stopped; any event if empty",
+	"waitTimeout":     "give up and exit 124 after this long, 0 waits forever",
+	"quiet":           "print nothing, exit with the code of the timer phase",
+	"setTimer":        "set timer interval, or the time the interval runs until, e.g. 25m, 14:30 or 'tomorrow 9am'",
+	"setBreak":        "set break interval, or the time the break runs until",
+	"startUntil":      "run the interval until a time, e.g. 12:00, 2:30pm or 'tomorrow 09:00'",
+	"setAlert":        "set alert thresholds before the end of an interval or break, e.g. 5m,1m (0 disables)",
+	"setLong":         "set long break interval",
+	"setCycle":        "set number of intervals per cycle, every Nth break is long (0 disables)",
+	"styleWidth":      "style progress bar width",
+	"styleBar":        "style progress bar appearance by number or name",
+	"styleIcon":       "style icon appearance by number or name",
+	"task":            "set the string for current task",
+	"toggleProgress":  "turn progress bar on/off",
+	"toggleBell":      "turn terminal bell on/off",
+	"toggleClock":     "display time on/off",
+	"toggleSymbol":    "display symbol on/off",
+	"toggleNotify":    "turn timer notifications on/off for notify-send",
+	"togglePercent":   "display interval percentage on/off",
+	"toggleRestart":   "turn automatic timer restart on/off",
+	"toggleReverse":   "timer displays time descending/ascending",
+	"toggleEnd":       "display the time the interval or break ends on/off",
+	"toggleTmux":      "turn timer notifications on/off for tmux",
 }
 
 var Shorthand = map[string]string{
-	"bar":      "b",
-	"progress": "p",
-	"bell":     "l",
-	"timer":    "t",
-	"icon":     "i",
-	"symbol":   "s",
-	"percent":  "P",
-	"notify":   "n",
-	"tmux":     "t",
-	"restart":  "r",
-	"reverse":  "v",
-	"clock":    "c",
-	"alert":    "a",
-	"break":    "k",
-	"width":    "w",
-	"help":     "h",
+	"bar":       "b",
+	"progress":  "p",
+	"bell":      "l",
+	"timer":     "t",
+	"icon":      "i",
+	"symbol":    "s",
+	"percent":   "P",
+	"notify":    "n",
+	"tmux":      "t",
+	"restart":   "r",
+	"reverse":   "v",
+	"end":       "e",
+	"clock":     "c",
+	"alert":     "a",
+	"break":     "k",
+	"longbreak": "L",
+	"cycle":     "C",
+	"elapsed":   "e",
+	"target":    "T",
+	"width":     "w",
+	"help":      "h",
+	"name":      "N",
+	"output":    "o",
+	"color":     "c",
+	"all":       "A",
+	"format":    "f",
+	"json":      "j",
+	"for":       "f",
+	"timeout":   "t",
+	"quiet":     "q",
+	"since":     "s",
+	"until":     "u",
 }
 
 func PrintBasicUsage() {
@@ -429,11 +1035,26 @@ func PrintBasicUsage() {
 	fmt.Printf("  pause\n\t%v\n", UsageString["pause"])
 	fmt.Printf("  resume\n\t%v\n", UsageString["resume"])
 	fmt.Printf("  break\n\t%v\n", UsageString["break"])
+	fmt.Printf("  stopwatch\n\t%v\n", UsageString["stopwatch"])
+	fmt.Printf("  lap\n\t%v\n", UsageString["lap"])
+	fmt.Printf("  wait\n\t%v\n", UsageString["wait"])
+	fmt.Printf("  skip\n\t%v\n", UsageString["skip"])
+	fmt.Printf("  finish\n\t%v\n", UsageString["finish"])
+	fmt.Printf("  reset\n\t%v\n", UsageString["reset"])
+	fmt.Printf("  extend\n\t%v\n", UsageString["extend"])
+	fmt.Printf("  shorten\n\t%v\n", UsageString["shorten"])
+	fmt.Printf("  snooze\n\t%v\n", UsageString["snooze"])
+	fmt.Printf("  adjust\n\t%v\n", UsageString["adjust"])
 	fmt.Printf("  run\n\t%v\n", UsageString["run"])
+	fmt.Printf("  routine\n\t%v\n", UsageString["routine"])
 	fmt.Printf("  task\n\t%v\n", UsageString["task"])
 	fmt.Printf("  clear\n\t%v\n", UsageString["clear"])
 	fmt.Printf("  status\n\t%v\n", UsageString["status"])
 	fmt.Printf("  info\n\t%v\n", UsageString["info"])
+	fmt.Printf("  list\n\t%v\n", UsageString["list"])
+	fmt.Printf("  report\n\t%v\n", UsageString["report"])
+	fmt.Printf("  export\n\t%v\n", UsageString["export"])
+	fmt.Printf("  daemon\n\t%v\n", UsageString["daemon"])
 	fmt.Printf("  clean\n\t%v\n", UsageString["clean"])
 	fmt.Printf("  help\n\t%v\n", UsageString["help"])
 	fmt.Printf("\n")
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// advisory locks are not available, writes are still atomic
+func LockFile(path string) (func(), error) {
+	return func() {}, nil
+}
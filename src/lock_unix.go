@@ -0,0 +1,34 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// take an exclusive advisory lock for path, blocking until other processes release it; the lock is
+// held on a separate lock file because writes replace the file itself
+func LockFile(path string) (func(), error) {
+	_, err := checkFilePath(filepath.Dir(path))
+	if err != nil {
+		err = createDirectory(filepath.Dir(path))
+		if err != nil {
+			return nil, err
+		}
+	}
+	file, err := os.OpenFile(path+lockSuffix, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
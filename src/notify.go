@@ -1,18 +1,463 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	Tmux "terminalTimer/tmuxmenu"
+)
+
+// notifier types of the notifiers list in config.json
+const (
+	notifierSend        = "notify-send"
+	notifierDBus        = "dbus"
+	notifierTmuxPopup   = "tmux-popup"
+	notifierTmuxMessage = "tmux-message"
+	notifierBell        = "bell"
+	notifierOSC9        = "osc9"
+	notifierOSC777      = "osc777"
+	notifierFIFO        = "fifo"
+	notifierFile        = "file"
 )
 
-func NotifySend(message string) error {
-	notifyCmd := "notify-send"
+var notifierTypes = []string{notifierSend, notifierDBus, notifierTmuxPopup, notifierTmuxMessage, notifierBell,
+	notifierOSC9, notifierOSC777, notifierFIFO, notifierFile}
+
+// terminal the bell and osc notifiers write to when no path is given
+const terminalPath = "/dev/tty"
+
+// enabled notification backend with its options, e.g. {"type": "file", "path": "~/timer.txt"}
+type NotifierConfig struct {
+	Type     string `json:"type"`
+	Path     string `json:"path,omitempty"`     // fifo or file to write to, or the terminal of bell and osc
+	Title    string `json:"title,omitempty"`    // title template, used when the event sets no title
+	Duration int    `json:"duration,omitempty"` // milliseconds a dbus or tmux-message notification stays visible, 0 uses the default
+}
+
+// notification text and appearance of an event in config.json, e.g.
+// {"title": "{task}", "body": "{next} break after {elapsed}", "urgency": "low", "icon": "coffee"}
+type MessageConfig struct {
+	Title   string `json:"title,omitempty"`
+	Body    string `json:"body,omitempty"`
+	Urgency string `json:"urgency,omitempty"` // low, normal or critical
+	Icon    string `json:"icon,omitempty"`    // icon name or path of desktop notifications
+}
+
+const (
+	defaultIcon      = "clock"
+	defaultUrgency   = "normal"
+	defaultTmuxTitle = " {symbol} Notification {symbol} "
+)
+
+// urgency levels of the desktop notification specification
+var urgencyLevels = map[string]byte{
+	"low":      0,
+	"normal":   1,
+	"critical": 2,
+}
+
+// event delivered to every enabled notifier
+type Notification struct {
+	Event   string
+	Name    string // timer the event happened to
+	Title   string // expanded for each notifier
+	Message string
+	Symbol  string // icon of the phase that follows the event
+	Urgency string
+	Icon    string
+	Actions []NotificationAction
+	Time    time.Time
+	Expand  func(format string) string // expand a template with the placeholders of the event
+}
+
+// button of a desktop notification, the key is the command the button runs
+type NotificationAction struct {
+	Key   string
+	Label string
+}
+
+type Notifier interface {
+	Notify(n Notification) error
+}
+
+type NotifySend struct{}
+
+// desktop notification through org.freedesktop.Notifications on the session bus
+type DBusNotifier struct {
+	Replaces *uint32 // id of the previous notification, replaced instead of stacking
+	Timeout  int
+	Debug    *History
+}
+
+type TmuxPopup struct{ Menu *Tmux.Menu }
+
+type TmuxMessage struct{ Duration int }
+
+// bell or osc escape sequence written to a terminal
+type TerminalNotifier struct {
+	Kind string
+	Path string
+}
+
+type FIFONotifier struct{ Path string }
+
+type FileNotifier struct{ Path string }
+
+func (NotifySend) Notify(n Notification) error {
 	notifyApp := "--app-name=" + programName
-	notifyIcon := "--icon=clock"
+	notifyIcon := "--icon=" + n.Icon
+	notifyUrgency := "--urgency=" + n.Urgency
+	return exec.Command("notify-send", n.Title, n.Message, notifyApp, notifyIcon, notifyUrgency).Run()
+}
 
-	cmd := exec.Command(notifyCmd, message, notifyApp, notifyIcon)
-	err := cmd.Run()
+func (b DBusNotifier) Notify(n Notification) error {
+	conn := notificationBus(b.Debug) // offers actions when this process stays around to run them
+	var actions []string
+	if conn != nil {
+		for _, a := range n.Actions {
+			actions = append(actions, a.Key, a.Label)
+		}
+	} else {
+		var err error
+		conn, err = DialSessionBus()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+	}
+	timeout := int32(-1) // server default
+	if b.Timeout > 0 {
+		timeout = int32(b.Timeout)
+	}
+	hints := map[string]DBusVariant{"urgency": {Signature: "y", Value: urgencyLevels[n.Urgency]}}
+	reply, err := conn.Call(notificationsName, notificationsPath, notificationsName, "Notify", "susssasa{sv}i",
+		programName, *b.Replaces, n.Icon, n.Title, n.Message, actions, hints, timeout)
 	if err != nil {
 		return err
 	}
+	id, ok := reply.Uint32Arg(0)
+	if !ok {
+		return errors.New("dbus Notify: reply without an id")
+	}
+	*b.Replaces = id
+	if len(actions) > 0 {
+		actionBus.Lock()
+		actionBus.timers[id] = n.Name
+		actionBus.Unlock()
+	}
 	return nil
 }
+
+func (p TmuxPopup) Notify(n Notification) error {
+	p.Menu.Close() // close any existing tmux popup before spawning a new one
+	return p.Menu.Open(n.Title, n.Message)
+}
+
+func (m TmuxMessage) Notify(n Notification) error {
+	args := []string{"display-message"}
+	if m.Duration > 0 {
+		args = append(args, "-d", strconv.Itoa(m.Duration))
+	}
+	args = append(args, fmt.Sprintf("%v %v", n.Symbol, n.Message))
+	return exec.Command("tmux", args...).Run()
+}
+
+func (w TerminalNotifier) Notify(n Notification) error {
+	var sequence string
+	switch w.Kind {
+	case notifierOSC9:
+		sequence = fmt.Sprintf("\x1b]9;%v\a", n.Message)
+	case notifierOSC777:
+		sequence = fmt.Sprintf("\x1b]777;notify;%v;%v\a", n.Title, n.Message)
+	default:
+		sequence = "\a"
+	}
+	if os.Getenv("TMUX") != "" && w.Kind != notifierBell { // let escapes pass through tmux
+		sequence = "\x1bPtmux;" + strings.ReplaceAll(sequence, "\x1b", "\x1b\x1b") + "\x1b\\"
+	}
+	return appendTo(w.Path, sequence, 0)
+}
+
+// one line per event, skipped when nothing reads the fifo
+func (f FIFONotifier) Notify(n Notification) error {
+	return appendTo(f.Path, notificationLine(n), syscall.O_NONBLOCK)
+}
+
+func (f FileNotifier) Notify(n Notification) error {
+	return appendTo(f.Path, notificationLine(n), os.O_CREATE)
+}
+
+// tab separated time, event and message
+func notificationLine(n Notification) string {
+	return fmt.Sprintf("%v\t%v\t%v\n", n.Time.Format(time.RFC3339), n.Event, n.Message)
+}
+
+func appendTo(path, text string, flag int) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|flag, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.WriteString(text)
+	return err
+}
+
+// replace a leading ~ with the home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// backend for an entry of the notifiers list
+func (t *Task) NewNotifier(c NotifierConfig) (Notifier, error) {
+	path := expandHome(c.Path)
+	switch c.Type {
+	case notifierSend:
+		return NotifySend{}, nil
+	case notifierDBus:
+		return DBusNotifier{Replaces: &t.State.NotificationID, Timeout: c.Duration, Debug: t.State.Debug}, nil
+	case notifierTmuxPopup:
+		return TmuxPopup{Menu: t.Tmux}, nil
+	case notifierTmuxMessage:
+		return TmuxMessage{Duration: c.Duration}, nil
+	case notifierBell, notifierOSC9, notifierOSC777:
+		if path == "" {
+			path = terminalPath
+		}
+		return TerminalNotifier{Kind: c.Type, Path: path}, nil
+	case notifierFIFO, notifierFile:
+		if path == "" {
+			return nil, fmt.Errorf("%v notifier needs a path", c.Type)
+		}
+		if c.Type == notifierFIFO {
+			return FIFONotifier{Path: path}, nil
+		}
+		return FileNotifier{Path: path}, nil
+	}
+	return nil, fmt.Errorf("unknown notifier %v, notifier types are %v", c.Type, strings.Join(notifierTypes, ", "))
+}
+
+// notification describing an event and what follows it, with the text and appearance configured for
+// the event
+func (t *Task) NewNotification(event string) Notification {
+	symbol := t.Symbols["on"]
+	switch {
+	case event == eventAlert:
+		symbol = t.Symbols["warning"]
+	case event == eventIntervalEnd && t.State.GetBreak() > 0, t.NextIsBreak():
+		symbol = t.Symbols["break"]
+	}
+	values := t.NotificationPlaceholders(event, symbol)
+	expand := func(format string) string { return ExpandTemplate(format, values) }
+	message := t.Config.Messages[event]
+	n := Notification{
+		Event:   event,
+		Name:    t.State.Name,
+		Title:   message.Title,
+		Message: t.EventMessage(event),
+		Symbol:  symbol,
+		Urgency: defaultUrgency,
+		Icon:    defaultIcon,
+		Actions: t.NotificationActions(event),
+		Time:    time.Now(),
+		Expand:  expand,
+	}
+	if message.Body != "" {
+		n.Message = expand(message.Body)
+	}
+	if _, ok := urgencyLevels[message.Urgency]; ok {
+		n.Urgency = message.Urgency
+	}
+	if message.Icon != "" {
+		n.Icon = expandHome(message.Icon)
+	}
+	return n
+}
+
+// format placeholders along with those describing the event: {event}, {message} and {symbol};
+// {elapsed} is the length of the phase that ended and {next} the length of the one that follows,
+// {left} is the threshold of an alert
+func (t *Task) NotificationPlaceholders(event, symbol string) map[string]func() string {
+	plain := *t // notifications are not colored
+	plain.ColorMode = colorNone
+	values := plain.Placeholders()
+	values["event"] = func() string { return event }
+	values["message"] = func() string { return t.EventMessage(event) }
+	values["symbol"] = func() string { return symbol }
+	var ended, next time.Duration
+	switch {
+	case event == eventAlert:
+		left := t.State.ReachedAlert()
+		values["left"] = func() string { return t.FormatTime(left) }
+		return values
+	case event == eventIntervalEnd && t.State.GetBreak() > 0:
+		ended, next = t.State.GetInterval(), t.State.GetBreak()
+	case event == eventIntervalEnd:
+		ended, next = t.State.GetInterval(), t.State.NextLength(t.Config.Restart)
+	case event == eventBreakEnd:
+		ended, next = t.State.GetBreak(), t.State.NextLength(t.Config.Restart)
+	default:
+		return values
+	}
+	values["elapsed"] = func() string { return t.FormatTime(ended) }
+	values["next"] = func() string { return t.FormatTime(next) }
+	return values
+}
+
+// buttons offered with the notification of an event
+func (t *Task) NotificationActions(event string) []NotificationAction {
+	snooze := NotificationAction{"snooze", fmt.Sprintf("Snooze %dm", int(snoozeStep.Minutes()))}
+	switch {
+	case t.State.InRoutine():
+		return []NotificationAction{{"skip", "Skip"}}
+	case event == eventAlert && t.State.TimerOnBreak():
+		return []NotificationAction{{"skip", "Skip break"}, snooze}
+	case event == eventAlert:
+		return []NotificationAction{{"break", "Start break"}, snooze}
+	case event == eventIntervalEnd && t.State.GetBreak() > 0:
+		return []NotificationAction{snooze, {"skip", "Skip break"}}
+	case t.Config.Restart:
+		return []NotificationAction{{"stop", "Stop"}}
+	}
+	return []NotificationAction{{"start", "Start"}, snooze}
+}
+
+// title template of the event, or of the notifier when the event has none
+func notificationTitle(title string, c NotifierConfig) string {
+	switch {
+	case title != "":
+		return title
+	case c.Title != "":
+		return c.Title
+	case c.Type == notifierTmuxPopup:
+		return defaultTmuxTitle
+	}
+	return programName
+}
+
+// deliver an event to every enabled notifier, failures go to the debug log
+func (t *Task) SendNotifications(event string) {
+	if len(t.Config.Notifiers) == 0 {
+		return
+	}
+	n := t.NewNotification(event)
+	id := t.State.NotificationID
+	defer func() {
+		if t.State.NotificationID != id {
+			t.State.Save()
+		}
+	}()
+	for _, c := range t.Config.Notifiers {
+		notifier, err := t.NewNotifier(c)
+		if err == nil {
+			titled := n
+			titled.Title = n.Expand(notificationTitle(n.Title, c))
+			err = notifier.Notify(titled)
+		}
+		if err != nil {
+			t.State.Debug.Print("NOTIFY:", c.Type, err)
+			continue
+		}
+		t.State.Debug.Print("NOTIFY:", c.Type, n.Message)
+	}
+}
+
+const (
+	notificationsName = "org.freedesktop.Notifications"
+	notificationsPath = "/org/freedesktop/Notifications"
+)
+
+// session bus connection of a long running process that waits for notification actions
+var actionBus struct {
+	sync.Mutex
+	enabled bool
+	conn    *DBusConn
+	timers  map[uint32]string // timer name per notification id
+}
+
+// offer actions with dbus notifications, for processes that keep running to invoke them
+func EnableNotificationActions() {
+	actionBus.Lock()
+	defer actionBus.Unlock()
+	actionBus.enabled = true
+	actionBus.timers = map[uint32]string{}
+}
+
+// connection listening for notification actions, nil unless actions are enabled; connects on first
+// use and again after the bus went away
+func notificationBus(debug *History) *DBusConn {
+	actionBus.Lock()
+	defer actionBus.Unlock()
+	if !actionBus.enabled {
+		return nil
+	}
+	if actionBus.conn != nil && !actionBus.conn.Closed() {
+		return actionBus.conn
+	}
+	conn, err := DialSessionBus()
+	if err != nil {
+		debug.Print("notificationBus():", err)
+		return nil
+	}
+	for _, member := range []string{"ActionInvoked", "NotificationClosed"} {
+		err = conn.AddMatch(fmt.Sprintf("type='signal',interface='%v',member='%v'", notificationsName, member))
+		if err != nil {
+			debug.Print("notificationBus():", err)
+			conn.Close()
+			return nil
+		}
+	}
+	actionBus.conn = conn
+	go listenActions(conn.Signals, func(name, key string) { InvokeAction(name, key, debug) })
+	return conn
+}
+
+// run the command of each action invoked on a notification sent by this process, until the
+// connection closes; notifications closed without an action are forgotten
+func listenActions(signals <-chan *DBusMessage, invoke func(name, key string)) {
+	for m := range signals {
+		id, _ := m.Uint32Arg(0)
+		actionBus.Lock()
+		name, ok := actionBus.timers[id]
+		if m.Member == "NotificationClosed" {
+			delete(actionBus.timers, id)
+		}
+		actionBus.Unlock()
+		if !ok || m.Member != "ActionInvoked" {
+			continue
+		}
+		key, _ := m.StringArg(1)
+		go invoke(name, key)
+	}
+}
+
+// run the command behind a notification action on the timer that sent the notification
+func InvokeAction(name, key string, debug *History) {
+	r := Request{Command: key, Name: name}
+	switch key {
+	case "snooze":
+		r.Args = []string{snoozeStep.String()}
+	case "break", "skip", "start", "stop":
+	default:
+		debug.Print("InvokeAction(): unknown action", key)
+		return
+	}
+	_, err := Dispatch(r)
+	if err != nil {
+		debug.Print("InvokeAction():", key, err)
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// machine readable output modes for status bars
+var outputModes = map[string]bool{
+	"waybar": true,
+	"i3bar":  true,
+	"json":   true,
+}
+
+// waybar custom module object, see return-type json
+type StatusOutput struct {
+	Text       string `json:"text"`
+	Tooltip    string `json:"tooltip"`
+	Class      string `json:"class"`
+	Percentage int    `json:"percentage"`
+}
+
+// status output with the timer details scripts tend to need
+type JSONOutput struct {
+	StatusOutput
+	Name      string `json:"name"`
+	Phase     string `json:"phase"`
+	Remaining int    `json:"remaining"` // seconds
+}
+
+// detailed status of a timer for status -json, durations in seconds
+type TimerStatus struct {
+	Name      string   `json:"name"`
+	Phase     string   `json:"phase"` // on, paused, break, breakp, expired or stopped
+	State     string   `json:"state"`
+	Paused    bool     `json:"paused"`
+	Remaining int      `json:"remaining"`
+	Elapsed   int      `json:"elapsed"`
+	Total     int      `json:"total"` // length of the current interval or break, or the stopwatch target
+	Percent   int      `json:"percent"`
+	Task      string   `json:"task"`
+	Start     string   `json:"start,omitempty"`
+	End       string   `json:"end,omitempty"` // projected end of the current interval or break
+	Count     int      `json:"count"`         // intervals completed in the current cycle
+	Cycle     int      `json:"cycle"`
+	Routine   string   `json:"routine,omitempty"`
+	Stopwatch bool     `json:"stopwatch"`
+	Laps      []int    `json:"laps,omitempty"` // stopwatch split times
+	Restart   bool     `json:"restart"`
+	Notifiers []string `json:"notifiers"` // types of the enabled notifiers
+	Bell      bool     `json:"bell"`
+}
+
+// interval values of a timer for info -json, durations in seconds
+type TimerInfo struct {
+	Name       string `json:"name"`
+	Interval   int    `json:"interval"`
+	Break      int    `json:"break"`
+	Alert      int    `json:"alert"`
+	Alerts     []int  `json:"alerts,omitempty"` // every alert threshold, longest first
+	LongBreak  int    `json:"longbreak"`
+	Cycle      int    `json:"cycle"`
+	Until      string `json:"until,omitempty"`      // wall clock end of the interval
+	BreakUntil string `json:"breakuntil,omitempty"` // wall clock end of the break
+	Target     int    `json:"target,omitempty"`
+	Laps       []int  `json:"laps,omitempty"`
+}
+
+// exit codes of status -quiet per phase, 1 and 2 are left to errors and usage
+var phaseExit = map[string]int{
+	"on":      0,
+	"break":   3,
+	"paused":  4,
+	"breakp":  5,
+	"expired": 6,
+	"stopped": 7,
+}
+
+// block of the i3bar protocol, also accepted by swaybar and i3blocks
+type I3Block struct {
+	FullText  string `json:"full_text"`
+	ShortText string `json:"short_text,omitempty"`
+	Name      string `json:"name"`
+	Instance  string `json:"instance"`
+	Urgent    bool   `json:"urgent,omitempty"`
+}
+
+func (t *Task) GetStatusOutput() StatusOutput {
+	return StatusOutput{
+		Text:       strings.TrimSpace(t.RenderString()),
+		Tooltip:    strings.TrimSpace(t.GetState()),
+		Class:      t.State.GetClass(),
+		Percentage: t.State.GetPercent(),
+	}
+}
+
+func (t *Task) GetStatusDetails() any {
+	status := TimerStatus{
+		Name:      t.State.GetName(),
+		Phase:     t.State.GetPhase(),
+		State:     stateString[t.State.GetPhase()],
+		Paused:    t.State.TimerIsPaused(),
+		Remaining: seconds(t.State.GetRemaining()),
+		Percent:   t.State.GetPercent(),
+		Task:      t.State.GetTask(),
+		Start:     timeString(t.State.TimeStart),
+		End:       timeString(t.State.GetEnd()),
+		Count:     t.State.Count,
+		Cycle:     t.State.Cycle,
+		Routine:   t.State.Routine,
+		Stopwatch: t.State.Stopwatch,
+		Laps:      secondsList(t.State.Laps),
+		Restart:   t.Config.Restart,
+		Notifiers: t.Config.NotifierTypes(),
+		Bell:      t.Config.Bell,
+	}
+	status.Elapsed = seconds(t.State.GetPhaseElapsed())
+	switch {
+	case t.State.TimerIsStopped():
+	case t.State.Stopwatch:
+		status.Total = seconds(t.State.Target)
+	default:
+		status.Total = seconds(t.State.PhaseLength())
+	}
+	return status
+}
+
+func (t *Task) GetInfoDetails() any {
+	return TimerInfo{
+		Name:       t.State.GetName(),
+		Interval:   seconds(t.State.GetInterval()),
+		Break:      seconds(t.State.GetBreak()),
+		Alert:      seconds(t.State.TimeAlert),
+		Alerts:     secondsList(t.State.GetAlerts()),
+		LongBreak:  seconds(t.State.TimeLongBreak),
+		Cycle:      t.State.Cycle,
+		Until:      timeString(t.State.Until),
+		BreakUntil: timeString(t.State.BreakUntil),
+		Target:     seconds(t.State.Target),
+		Laps:       secondsList(t.State.Laps),
+	}
+}
+
+// status or info as text, as a json line with "json", or expanded from a template with "format=..."
+func (t *Task) StatusString(command string, args []string) (string, error) {
+	mode, format, _ := strings.Cut(strings.Join(args, " "), "=")
+	switch mode {
+	case "":
+		return t.Status[command](), nil
+	case "json":
+		line, err := json.Marshal(t.Details[command]())
+		if err != nil {
+			return "", err
+		}
+		return string(line) + "\n", nil
+	case "format":
+		return t.ExpandFormat(format) + "\n", nil
+	}
+	return "", fmt.Errorf("invalid output: %v", mode)
+}
+
+// rounded whole seconds of a duration
+func seconds(d time.Duration) int {
+	return int(d.Round(time.Second).Seconds())
+}
+
+func secondsList(durations []time.Duration) []int {
+	list := []int{}
+	for _, d := range durations {
+		list = append(list, seconds(d))
+	}
+	return list
+}
+
+// RFC3339 time, empty for the zero time
+func timeString(v time.Time) string {
+	if v.IsZero() {
+		return ""
+	}
+	return v.Format(time.RFC3339)
+}
+
+// single line json object for the given output mode
+func (t *Task) Output(mode string) ([]byte, error) {
+	status := t.GetStatusOutput()
+	switch mode {
+	case "i3bar":
+		class := t.State.GetClass()
+		return json.Marshal(I3Block{
+			FullText:  status.Text,
+			ShortText: strings.TrimSpace(t.DrawTime()),
+			Name:      programName,
+			Instance:  t.State.GetName(),
+			Urgent:    class == "warning" || class == "expired",
+		})
+	case "json":
+		return json.Marshal(JSONOutput{
+			StatusOutput: status,
+			Name:         t.State.GetName(),
+			Phase:        t.State.GetPhase(),
+			Remaining:    seconds(t.State.GetRemaining()),
+		})
+	default:
+		return json.Marshal(status)
+	}
+}
+
+// print one json line per tick; i3bar output is wrapped in the i3bar protocol header and array
+func (t *Task) RunStream(mode string) error {
+	redraw := time.NewTicker(1 * time.Second)
+	if mode == "i3bar" {
+		fmt.Printf("{\"version\":1}\n[\n")
+	}
+	for {
+		updatedTask, err := InitializeNamedTimer(t.State.Name) // pick up changes from other commands
+		if err == nil {
+			t = &updatedTask
+		}
+		t.GetTime()
+		line, err := t.Output(mode)
+		if err != nil {
+			return err
+		}
+		if mode == "i3bar" {
+			fmt.Printf("[%s],\n", line)
+		} else {
+			fmt.Printf("%s\n", line)
+		}
+		<-redraw.C
+	}
+}
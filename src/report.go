@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const reportDayFormat = "2006-01-02"
+
+// totals of work sessions over some period
+type Totals struct {
+	Label     string
+	Sessions  int
+	Completed int
+	Active    time.Duration
+}
+
+func (r *Totals) Add(s Session) {
+	r.Sessions++
+	if s.Completed {
+		r.Completed++
+	}
+	r.Active += s.Active()
+}
+
+type Report struct {
+	Days          []*Totals
+	Weeks         []*Totals
+	Tasks         []*Totals
+	Breaks        Totals
+	Work          Totals
+	StreakCurrent int
+	StreakLongest int
+}
+
+// summarize work sessions per day, per week and per task
+func BuildReport(sessions []Session, now time.Time) Report {
+	var r Report
+	days := map[string]*Totals{}
+	weeks := map[string]*Totals{}
+	tasks := map[string]*Totals{}
+	completedDays := map[string]bool{}
+	for _, s := range sessions {
+		if s.Kind == phaseBreak {
+			r.Breaks.Add(s)
+			continue
+		}
+		r.Work.Add(s)
+		local := s.Start.Local()
+		day := local.Format(reportDayFormat)
+		year, week := local.ISOWeek()
+		task := s.Task
+		if task == "" {
+			task = "(no task)"
+		}
+		addTotals(days, &r.Days, day).Add(s)
+		addTotals(weeks, &r.Weeks, fmt.Sprintf("%d-W%02d", year, week)).Add(s)
+		addTotals(tasks, &r.Tasks, task).Add(s)
+		if s.Completed {
+			completedDays[day] = true
+		}
+	}
+	sort.Slice(r.Days, func(i, j int) bool { return r.Days[i].Label < r.Days[j].Label })
+	sort.Slice(r.Weeks, func(i, j int) bool { return r.Weeks[i].Label < r.Weeks[j].Label })
+	sort.Slice(r.Tasks, func(i, j int) bool { return r.Tasks[i].Active > r.Tasks[j].Active })
+	r.StreakCurrent, r.StreakLongest = streaks(completedDays, now)
+	return r
+}
+
+func addTotals(index map[string]*Totals, list *[]*Totals, label string) *Totals {
+	totals, ok := index[label]
+	if !ok {
+		totals = &Totals{Label: label}
+		index[label] = totals
+		*list = append(*list, totals)
+	}
+	return totals
+}
+
+// consecutive days with at least one completed interval; the current streak may end today or yesterday
+func streaks(days map[string]bool, now time.Time) (current, longest int) {
+	var sorted []string
+	for day := range days {
+		sorted = append(sorted, day)
+	}
+	sort.Strings(sorted)
+	var run int
+	var previous time.Time
+	for _, day := range sorted {
+		date, err := time.ParseInLocation(reportDayFormat, day, time.Local)
+		if err != nil {
+			continue
+		}
+		if !previous.IsZero() && previous.AddDate(0, 0, 1).Equal(date) {
+			run++
+		} else {
+			run = 1
+		}
+		if run > longest {
+			longest = run
+		}
+		previous = date
+	}
+	today := now.Local().Format(reportDayFormat)
+	yesterday := now.Local().AddDate(0, 0, -1).Format(reportDayFormat)
+	if len(sorted) > 0 && (sorted[len(sorted)-1] == today || sorted[len(sorted)-1] == yesterday) {
+		current = run
+	}
+	return current, longest
+}
+
+// percentage of work sessions that ran to completion
+func (r Report) CompletionRate() int {
+	if r.Work.Sessions == 0 {
+		return 0
+	}
+	return r.Work.Completed * 100 / r.Work.Sessions
+}
+
+func (r Report) String() string {
+	var b strings.Builder
+	section := func(title string, totals []*Totals) {
+		fmt.Fprintf(&b, "%v\n", title)
+		for _, t := range totals {
+			fmt.Fprintf(&b, "  %-24v %8v %4d/%d\n", t.Label, FormatHours(t.Active), t.Completed, t.Sessions)
+		}
+		fmt.Fprintf(&b, "\n")
+	}
+	section("day", r.Days)
+	section("week", r.Weeks)
+	section("task", r.Tasks)
+	fmt.Fprintf(&b, "work       %8v in %d sessions\n", FormatHours(r.Work.Active), r.Work.Sessions)
+	fmt.Fprintf(&b, "break      %8v in %d sessions\n", FormatHours(r.Breaks.Active), r.Breaks.Sessions)
+	fmt.Fprintf(&b, "completed  %7d%% (%d/%d)\n", r.CompletionRate(), r.Work.Completed, r.Work.Sessions)
+	fmt.Fprintf(&b, "streak     %8d days (longest %d)\n", r.StreakCurrent, r.StreakLongest)
+	return b.String()
+}
+
+// format a duration as hours and minutes, e.g. 12:05
+func FormatHours(d time.Duration) string {
+	d = d.Round(time.Minute)
+	return fmt.Sprintf("%d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
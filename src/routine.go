@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	phaseWork  = "work"
+	phaseBreak = "break"
+)
+
+// single named step of a routine, e.g. {"name": "deep work", "duration": "50m", "kind": "work"}
+type Phase struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration"`
+	Kind     string        `json:"kind"`
+}
+
+func (p Phase) IsBreak() bool { return p.Kind == phaseBreak }
+
+// durations are written as strings so routines can be edited by hand in config.json
+func (p Phase) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Name     string `json:"name"`
+		Duration string `json:"duration"`
+		Kind     string `json:"kind"`
+	}{p.Name, p.Duration.String(), p.Kind})
+}
+
+// accept duration strings ("50m") as well as integer nanoseconds
+func (p *Phase) UnmarshalJSON(bytes []byte) error {
+	var raw struct {
+		Name     string          `json:"name"`
+		Duration json.RawMessage `json:"duration"`
+		Kind     string          `json:"kind"`
+	}
+	err := json.Unmarshal(bytes, &raw)
+	if err != nil {
+		return err
+	}
+	p.Name = raw.Name
+	p.Kind = raw.Kind
+	var str string
+	if json.Unmarshal(raw.Duration, &str) == nil {
+		p.Duration, err = time.ParseDuration(str)
+		return err
+	}
+	var ns int64
+	err = json.Unmarshal(raw.Duration, &ns)
+	if err != nil {
+		return err
+	}
+	p.Duration = time.Duration(ns)
+	return nil
+}
+
+// return an error if a routine cannot be run
+func ValidatePhases(phases []Phase) error {
+	if len(phases) == 0 {
+		return errors.New("routine has no phases")
+	}
+	for k, p := range phases {
+		if p.Duration <= 0 {
+			return fmt.Errorf("phase %d (%v) has no duration", k+1, p.Name)
+		}
+		if p.Kind != phaseWork && p.Kind != phaseBreak {
+			return fmt.Errorf("phase %d (%v) kind must be %q or %q", k+1, p.Name, phaseWork, phaseBreak)
+		}
+	}
+	return nil
+}
+
+// routine is running when phases were copied into state
+func (s *State) InRoutine() bool {
+	return s.Routine != "" && s.Phase >= 0 && s.Phase < len(s.Phases)
+}
+
+// current routine phase, ok is false outside of a routine
+func (s *State) CurrentPhase() (Phase, bool) {
+	if !s.InRoutine() {
+		return Phase{}, false
+	}
+	return s.Phases[s.Phase], true
+}
+
+// phase that follows the current one, looping to the first phase if restart is set
+func (s *State) PeekPhase(restart bool) (Phase, bool) {
+	if !s.InRoutine() {
+		return Phase{}, false
+	}
+	switch {
+	case s.Phase+1 < len(s.Phases):
+		return s.Phases[s.Phase+1], true
+	case restart:
+		return s.Phases[0], true
+	}
+	return Phase{}, false
+}
+
+func (s *State) ClearRoutine() {
+	s.Routine = ""
+	s.Phases = nil
+	s.Phase = 0
+}
+
+// sorted names of the routines defined in config
+func (c *Config) RoutineNames() []string {
+	var names []string
+	for name := range c.Routines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// copy a routine from config into state and start its first phase
+func (t *Task) StartRoutine(name string) error {
+	phases, ok := t.Config.Routines[name]
+	if !ok {
+		return fmt.Errorf("routine %q not found", name)
+	}
+	err := ValidatePhases(phases)
+	if err != nil {
+		return fmt.Errorf("routine %q: %w", name, err)
+	}
+	t.EndSession()
+	t.State.ClearStopwatch()
+	t.State.Routine = name
+	t.State.Phases = phases
+	t.State.Phase = 0
+	t.State.SetStart(time.Now())
+	t.State.SetPause(time.Time{})
+	err = t.State.Save()
+	if err != nil {
+		t.State.Debug.Print("StartRoutine()", err)
+		return err
+	}
+	t.Message("routine " + name)
+	t.QueueHook(hookStart)
+	return nil
+}
+
+// move to the routine phase that follows the one that has elapsed, starting it when the elapsed
+// phase ended; the last phase stops the timer and clears the routine, or loops
+func (t *Task) NextPhase() error {
+	if !t.State.InRoutine() || !t.State.TimerHasExpired() {
+		return nil
+	}
+	t.RecordSessions()
+	end := t.State.GetBreakEnd()
+	switch {
+	case t.State.Phase+1 < len(t.State.Phases):
+		t.State.Phase++
+	case t.Config.Restart:
+		t.State.Phase = 0
+	default: // routine complete, the run ends
+		t.State.ClearRoutine()
+		t.State.SetStart(time.Time{})
+		t.State.Count = 0
+	}
+	if t.State.InRoutine() {
+		t.State.SetStart(end)
+		t.State.ResetSession()
+	}
+	err := t.State.Save()
+	if err != nil {
+		t.State.Debug.Print("NextPhase()", err)
+		return err
+	}
+	if phase, ok := t.State.CurrentPhase(); ok {
+		t.Message("phase " + phase.Name)
+	} else {
+		t.Message("routine complete")
+	}
+	return nil
+}
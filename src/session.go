@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// interrupted sessions shorter than this are not recorded, e.g. a start shortly followed by a stop
+const minInterrupted = time.Minute
+
+// completed or interrupted work interval or break, stored one json object per line in SessionFile
+type Session struct {
+	Timer     string        `json:"timer"`
+	Kind      string        `json:"kind"`            // work or break
+	Phase     string        `json:"phase,omitempty"` // routine phase name
+	Start     time.Time     `json:"start"`
+	End       time.Time     `json:"end"`
+	Paused    time.Duration `json:"paused"`
+	Task      string        `json:"task"`
+	Completed bool          `json:"completed"` // false if the session was stopped early
+}
+
+// time spent in the session, excluding pauses
+func (s Session) Active() time.Duration {
+	d := s.End.Sub(s.Start) - s.Paused
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// wall clock time the current interval started, TimeStart is shifted forward by every pause
+func (s *State) GetWorkStart() time.Time {
+	return s.TimeStart.Add(-s.PausedInterval - s.PausedBreak)
+}
+
+// wall clock time the current interval ended and the break started
+func (s *State) GetWorkEnd() time.Time {
+	return s.GetWorkStart().Add(s.GetInterval() + s.PausedInterval)
+}
+
+// wall clock time the current break ends
+func (s *State) GetBreakEnd() time.Time {
+	return s.GetWorkEnd().Add(s.GetBreakLeft() + s.PausedBreak)
+}
+
+// pause time of the running pause, if any
+func (s *State) GetPauseOngoing() time.Duration {
+	if !s.TimerIsPaused() {
+		return 0
+	}
+	return time.Since(s.TimePause)
+}
+
+func (s *State) NewSession(kind string, start, end time.Time, paused time.Duration, completed bool) Session {
+	var phase string
+	if p, ok := s.CurrentPhase(); ok {
+		phase = p.Name
+	}
+	return Session{
+		Timer:     s.GetName(),
+		Kind:      kind,
+		Phase:     phase,
+		Start:     start,
+		End:       end,
+		Paused:    paused,
+		Task:      s.Task,
+		Completed: completed,
+	}
+}
+
+// record intervals and breaks that have run to completion since they were last recorded
+func (t *Task) RecordSessions() bool {
+	var changed bool
+	if t.State.TimerIsStopped() {
+		return false
+	}
+	if (t.State.TimerOnBreak() || t.State.TimerHasExpired()) && t.State.Recorded == "" {
+		if t.State.GetInterval() > 0 {
+			t.WriteSession(t.State.NewSession(phaseWork, t.State.GetWorkStart(), t.State.GetWorkEnd(), t.State.PausedInterval, true))
+		}
+		t.State.Recorded = phaseWork
+		changed = true
+	}
+	if t.State.TimerHasExpired() && t.State.Recorded != phaseBreak {
+		if t.State.GetBreak() > 0 {
+			t.WriteSession(t.State.NewSession(phaseBreak, t.State.GetWorkEnd(), t.State.GetBreakEnd(), t.State.PausedBreak, true))
+		}
+		t.State.Recorded = phaseBreak
+		changed = true
+	}
+	return changed
+}
+
+// record the interval or break in progress as stopped early and reset session tracking
+func (t *Task) EndSession() {
+	t.RecordSessions()
+	var session Session
+	now := time.Now()
+	switch {
+	case t.State.TimerIsStopped() || t.State.TimerHasExpired():
+		t.State.ResetSession()
+		return
+	case t.State.TimerOnBreak():
+		session = t.State.NewSession(phaseBreak, t.State.GetWorkEnd(), now, t.State.PausedBreak+t.State.GetPauseOngoing(), false)
+	default: // a stopwatch has no end, stopping it completes the session
+		session = t.State.NewSession(phaseWork, t.State.GetWorkStart(), now, t.State.PausedInterval+t.State.GetPauseOngoing(), t.State.Stopwatch)
+	}
+	if session.Active() >= minInterrupted {
+		t.WriteSession(session)
+	}
+	t.State.ResetSession()
+}
+
+func (s *State) ResetSession() {
+	s.Recorded = ""
+	s.PausedInterval = 0
+	s.PausedBreak = 0
+	s.IntervalExtra = 0
+	s.BreakExtra = 0
+	s.BreakOffset = 0
+}
+
+// append a session to the history file
+func (t *Task) WriteSession(session Session) {
+	file, err := ReturnLogFile(SessionFile)
+	if err != nil {
+		t.State.Debug.Print("WriteSession()", err)
+		return
+	}
+	defer file.Close()
+	bytes, err := json.Marshal(session)
+	if err != nil {
+		t.State.Debug.Print("WriteSession()", err)
+		return
+	}
+	_, err = file.Write(append(bytes, '\n'))
+	if err != nil {
+		t.State.Debug.Print("WriteSession()", err)
+	}
+}
+
+// read every session from the history file, lines that fail to parse are skipped
+func ReadSessions() ([]Session, error) {
+	dir, err := StateDirectory()
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filepath.Join(dir, SessionFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var sessions []Session
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var s Session
+		if json.Unmarshal(scanner.Bytes(), &s) != nil {
+			continue
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, scanner.Err()
+}
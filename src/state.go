@@ -2,43 +2,242 @@ package main
 
 import (
 	"encoding/json"
-	"time"
-	"path/filepath"
+	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
 )
-// initialize and/or load state data structure along with a history logger
-func InitializeState() (*State, error) {
+
+// initialize and/or load state data structure of a named timer along with a history logger
+func InitializeState(name string) (*State, error) {
 	var s State
 	debug, err := InitializeDebugLog()
 	if err != nil {
 		s.Debug.Enable(false) // don't attempt to log
 	}
 	s.Debug = debug
+	s.Name = name
 	s.Load()
 	return &s, nil
 }
 
+// timer names become part of a file name, restrict them to a safe character set
+func ValidTimerName(name string) bool {
+	if name == "" || strings.HasPrefix(name, ".") {
+		return false
+	}
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' && r != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// state file name for a timer, the default timer keeps using state.json
+func StateFileName(name string) string {
+	if name == "" || name == DefaultTimer {
+		return StateFile
+	}
+	return fmt.Sprintf("%v-%v%v", strings.TrimSuffix(StateFile, ".json"), name, filepath.Ext(StateFile))
+}
+
+// true when the named timer has a state file, the default timer always exists; commands that only
+// read a timer report unknown names instead of showing a new default state
+func TimerExists(name string) bool {
+	if name == "" || name == DefaultTimer {
+		return true
+	}
+	path, err := StatePath(name)
+	if err != nil {
+		return false
+	}
+	_, err = checkFilePath(path)
+	return err == nil
+}
+
+// directory holding the state files of every timer
+func StateDirectory() (string, error) {
+	path, err := os.UserCacheDir()
+	if err != nil {
+		path, err = os.Executable()
+		if err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(path, programName), nil
+}
+
+// path of the state file of a timer
+func StatePath(name string) (string, error) {
+	dir, err := StateDirectory()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, StateFileName(name)), nil
+}
+
+// names of all timers that have a state file, default timer first
+func TimerNames() ([]string, error) {
+	dir, err := StateDirectory()
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.TrimSuffix(StateFile, ".json") + "-"
+	files, err := filepath.Glob(filepath.Join(dir, prefix+"*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	_, err = checkFilePath(filepath.Join(dir, StateFile))
+	if err == nil {
+		names = append(names, DefaultTimer)
+	}
+	var named []string
+	for _, file := range files {
+		name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), prefix), ".json")
+		if ValidTimerName(name) {
+			named = append(named, name)
+		}
+	}
+	sort.Strings(named)
+	return append(names, named...), nil
+}
+
 func (s *State) UseDefaults() {
 	s.TimeStart = time.Now()
 	s.TimePause = time.Time{}
 	s.TimeInterval = time.Duration(25 * time.Minute)
 	s.TimeBreak = time.Duration(5 * time.Minute)
 	s.TimeAlert = time.Duration(2 * time.Minute)
+	s.TimeLongBreak = time.Duration(15 * time.Minute)
+	s.Cycle = 4
+	s.Count = 0
 	s.Task = ""
 }
 
 type State struct {
-	TimeStart    time.Time     `json:"start"`
-	TimePause    time.Time     `json:"pause"`
-	TimeInterval time.Duration `json:"interval"`
-	TimeBreak    time.Duration `json:"break"`
-	TimeAlert    time.Duration `json:"alert"`
-	Task         string        `json:"task"`
-	Debug        *History      `json:"-"`
+	TimeStart        time.Time       `json:"start"`
+	TimePause        time.Time       `json:"pause"`
+	TimeInterval     time.Duration   `json:"interval"`
+	TimeBreak        time.Duration   `json:"break"`
+	TimeAlert        time.Duration   `json:"alert"`  // longest alert threshold
+	Alerts           []time.Duration `json:"alerts"` // alert thresholds, longest first
+	TimeLongBreak    time.Duration   `json:"longbreak"`
+	Cycle            int             `json:"cycle"`   // every Nth break is a long break, 0 disables
+	Count            int             `json:"count"`   // intervals completed in the current cycle
+	Routine          string          `json:"routine"` // name of the running routine, empty if none
+	Phases           []Phase         `json:"phases"`
+	Phase            int             `json:"phase"` // index of the current routine phase
+	Task             string          `json:"task"`
+	Recorded         string          `json:"recorded"`         // last phase of the current run written to history
+	PausedInterval   time.Duration   `json:"pausedinterval"`   // pause time accumulated during the interval
+	PausedBreak      time.Duration   `json:"pausedbreak"`      // pause time accumulated during the break
+	NotifiedInterval time.Time       `json:"notifiedinterval"` // due time of the last interval end fired
+	NotifiedBreak    time.Time       `json:"notifiedbreak"`    // due time of the last break end fired
+	NotifiedAlert    time.Time       `json:"notifiedalert"`    // time the last alert was fired
+	AlertPhase       string          `json:"alertphase"`       // interval or break the last alert was fired in
+	AlertFired       time.Duration   `json:"alertfired"`       // shortest threshold fired in that phase
+	NotificationID   uint32          `json:"notificationid"`   // desktop notification replaced by the next one
+	IntervalExtra    time.Duration   `json:"intervalextra"`    // extend or shorten of the current interval
+	BreakExtra       time.Duration   `json:"breakextra"`       // extend or shorten of the current break
+	BreakOffset      time.Duration   `json:"breakoffset"`      // break time counted as passed at the interval end
+	Until            time.Time       `json:"until"`            // wall clock end of the interval, zero for a relative interval
+	BreakUntil       time.Time       `json:"breakuntil"`       // wall clock end of the break, zero for a relative break
+	Stopwatch        bool            `json:"stopwatch"`        // count up with no interval or break
+	Target           time.Duration   `json:"target"`           // optional soft target of the stopwatch
+	Laps             []time.Duration `json:"laps"`             // stopwatch split times
+	Name             string          `json:"-"`                // timer name, selects the state file
+	Debug            *History        `json:"-"`
 }
 
 func (s *State) GetTask() string { return s.Task }
 
+// display name of the timer
+func (s *State) GetName() string {
+	if s.Name == "" {
+		return DefaultTimer
+	}
+	return s.Name
+}
+
+// key of stateString describing the current phase
+func (s *State) GetPhase() string {
+	switch {
+	case s.TimerIsStopped():
+		return "stopped"
+	case s.TimerHasExpired():
+		return "expired"
+	case s.TimerOnBreak() && s.TimerIsPaused():
+		return "breakp"
+	case s.TimerOnBreak():
+		return "break"
+	case s.TimerIsPaused():
+		return "paused"
+	default:
+		return "on"
+	}
+}
+
+// interval duration for the current routine phase or the configured interval, plus any extension
+func (s *State) GetInterval() time.Duration {
+	if s.InRoutine() {
+		if s.Phases[s.Phase].IsBreak() {
+			return 0
+		}
+		return s.Phases[s.Phase].Duration + s.IntervalExtra
+	}
+	if !s.Until.IsZero() {
+		return s.untilInterval() + s.IntervalExtra
+	}
+	return s.TimeInterval + s.IntervalExtra
+}
+
+// returns if the break following the current interval is the long break of the cycle
+func (s *State) OnLongBreak() bool {
+	if s.InRoutine() {
+		return false
+	}
+	return s.Cycle > 0 && s.TimeLongBreak > 0 && (s.Count+1)%s.Cycle == 0
+}
+
+// break duration for the current position in the cycle, plus any extension
+func (s *State) GetBreak() time.Duration {
+	if s.InRoutine() {
+		if s.Phases[s.Phase].IsBreak() {
+			return s.Phases[s.Phase].Duration + s.BreakExtra
+		}
+		return 0
+	}
+	if !s.BreakUntil.IsZero() {
+		return s.untilBreak() + s.BreakExtra
+	}
+	if s.OnLongBreak() {
+		return s.TimeLongBreak + s.BreakExtra
+	}
+	return s.TimeBreak + s.BreakExtra
+}
+
+// current position in the cycle, e.g. "3/4"; empty if cycles are disabled
+func (s *State) GetCycle() string {
+	if s.Cycle <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d", s.Count%s.Cycle+1, s.Cycle)
+}
+
+// advance cycle position after an interval has been completed
+func (s *State) NextCycle() {
+	if s.Cycle <= 0 {
+		s.Count = 0
+		return
+	}
+	s.Count = (s.Count + 1) % s.Cycle
+}
+
 // zero start time returns stopped timmer
 func (s *State) TimerIsStopped() bool { return s.TimeStart.IsZero() }
 
@@ -47,29 +246,43 @@ func (s *State) TimerIsPaused() bool { return !s.TimePause.IsZero() }
 
 // returns if timer is inside alert window
 func (s *State) TimerOnAlert() bool {
-	return time.Since(s.TimeStart) > s.TimeInterval-s.TimeAlert && time.Since(s.TimeStart) < s.TimeInterval
+	if s.Stopwatch {
+		return false
+	}
+	return time.Since(s.TimeStart) > s.GetInterval()-s.TimeAlert && time.Since(s.TimeStart) < s.GetInterval()
 }
 
 // returns if elapsed time is greater than interval but less than interval+break; if on break, subtract pause time
 func (s *State) TimerOnBreak() bool {
+	if s.Stopwatch {
+		return false
+	}
 	if s.TimePause.IsZero() {
-		return time.Since(s.TimeStart) > s.TimeInterval && time.Since(s.TimeStart) < (s.TimeInterval+s.TimeBreak)
+		return time.Since(s.TimeStart) > s.GetInterval() && time.Since(s.TimeStart) < (s.GetInterval()+s.GetBreakLeft())
 	}
 	if !s.TimePause.IsZero() {
 		t := time.Since(s.TimeStart) - time.Since(s.TimePause)
-		return t > s.TimeInterval && t < s.TimeInterval+s.TimeBreak
+		return t > s.GetInterval() && t < s.GetInterval()+s.GetBreakLeft()
 	}
 	return false
 }
 
 // elapsed time is greater than interval + break; timer is not paused
 func (s *State) TimerHasExpired() bool {
-	return time.Since(s.TimeStart) >= s.TimeInterval+s.TimeBreak && s.TimePause.IsZero()
+	if s.Stopwatch {
+		return false
+	}
+	return time.Since(s.TimeStart) >= s.GetInterval()+s.GetBreakLeft() && s.TimePause.IsZero()
+}
+
+// part of the break still ahead at the interval end, the break offset counts as already passed
+func (s *State) GetBreakLeft() time.Duration {
+	return s.GetBreak() - s.BreakOffset
 }
 
 // time since s.TimeStart aka time.Now().Sub(t.TimeStart)
 func (s *State) GetTotal() time.Duration {
-	return s.TimeInterval + s.TimeBreak
+	return s.GetInterval() + s.GetBreak()
 }
 
 // time since s.TimeStart aka time.Now().Sub(t.TimeStart)
@@ -77,37 +290,152 @@ func (s *State) GetElapsed() time.Duration {
 	return time.Since(s.TimeStart)
 }
 func (s *State) GetElapsedBreak() time.Duration {
-	return time.Since(s.TimeStart) - s.TimeInterval
+	return time.Since(s.TimeStart) - s.GetInterval() + s.BreakOffset
 }
 func (s *State) GetElapsedPaused() time.Duration {
 	return time.Since(s.TimeStart) - time.Since(s.TimePause)
 }
 func (s *State) GetElapsedPausedBreak() time.Duration {
-	return time.Since(s.TimeStart) - time.Since(s.TimePause) - s.TimeInterval
+	return time.Since(s.TimeStart) - time.Since(s.TimePause) - s.GetInterval() + s.BreakOffset
 }
 
 // interval time remaining plus pause time, can be negative
 func (s *State) GetRemainingPaused() time.Duration {
-	return (s.TimeInterval + time.Since(s.TimePause)) - time.Since(s.TimeStart)
+	return (s.GetInterval() + time.Since(s.TimePause)) - time.Since(s.TimeStart)
 }
 func (s *State) GetRemainingPausedBreak() time.Duration {
-	return (s.TimeInterval + s.TimeBreak + time.Since(s.TimePause)) - time.Since(s.TimeStart)
+	return (s.GetInterval() + s.GetBreakLeft() + time.Since(s.TimePause)) - time.Since(s.TimeStart)
 }
 func (s *State) GetRemainingBreak() time.Duration {
-	return (s.TimeInterval + s.TimeBreak) - time.Since(s.TimeStart)
+	return (s.GetInterval() + s.GetBreakLeft()) - time.Since(s.TimeStart)
 }
 
 // interval time remaining, can be negative
 func (s *State) GetIntervalRemaining() time.Duration {
-	return s.TimeInterval - time.Since(s.TimeStart)
+	return s.GetInterval() - time.Since(s.TimeStart)
+}
+
+// percent complete of the current interval or break
+func (s *State) GetPercent() int {
+	return int(s.GetProgress() * 100.0)
+}
+
+// fraction complete of the current interval or break
+func (s *State) GetProgress() float64 {
+	switch {
+	case s.TimerIsStopped():
+		return 0
+	case s.Stopwatch:
+		return s.GetStopwatchProgress()
+	case s.TimerHasExpired():
+		return 1
+	case s.TimerOnBreak() && s.TimerIsPaused():
+		return float64(s.GetElapsedPausedBreak()) / float64(s.GetBreak())
+	case s.TimerOnBreak():
+		return float64(s.GetElapsedBreak()) / float64(s.GetBreak())
+	case s.TimerIsPaused():
+		return float64(s.GetElapsedPaused()) / float64(s.GetInterval())
+	default:
+		return float64(s.GetElapsed()) / float64(s.GetInterval())
+	}
+}
+
+// style class of the current phase, following the icon selection of DrawIcon
+func (s *State) GetClass() string {
+	switch {
+	case s.TimerIsStopped():
+		return "stopped"
+	case s.TimerHasExpired():
+		return "expired"
+	case s.TimerIsPaused():
+		return "paused"
+	case s.TimerOnBreak():
+		return "break"
+	case s.TimerOnAlert():
+		return "warning"
+	default:
+		return "running"
+	}
+}
+
+// time remaining in the current interval or break, accounting for pause
+func (s *State) GetRemaining() time.Duration {
+	switch {
+	case s.TimerIsStopped() || s.TimerHasExpired():
+		return 0
+	case s.Stopwatch && s.Target > s.GetStopwatchElapsed():
+		return s.Target - s.GetStopwatchElapsed()
+	case s.Stopwatch:
+		return 0
+	case s.TimerIsPaused() && s.TimerOnBreak():
+		return s.GetRemainingPausedBreak()
+	case s.TimerIsPaused():
+		return s.GetRemainingPaused()
+	case s.TimerOnBreak():
+		return s.GetRemainingBreak()
+	default:
+		return s.GetIntervalRemaining()
+	}
+}
+
+// time spent in the interval or break in progress, or counted by the stopwatch
+func (s *State) GetPhaseElapsed() time.Duration {
+	switch {
+	case s.TimerIsStopped():
+		return 0
+	case s.Stopwatch:
+		return s.GetStopwatchElapsed()
+	}
+	return s.PhaseLength() - s.GetRemaining()
+}
+
+// length of the phase that follows the current one, zero when there is none
+func (s *State) NextLength(restart bool) time.Duration {
+	switch {
+	case s.TimerIsStopped() || s.Stopwatch:
+		return 0
+	case s.InRoutine():
+		next, ok := s.PeekPhase(restart)
+		if !ok {
+			return 0
+		}
+		return next.Duration
+	case s.TimerOnBreak() || s.TimerHasExpired():
+		return s.TimeInterval
+	}
+	return s.GetBreak()
+}
+
+// projected wall clock time the current interval or break ends, zero when there is no end
+func (s *State) GetEnd() time.Time {
+	if s.TimerIsStopped() || s.TimerHasExpired() {
+		return time.Time{}
+	}
+	if s.Stopwatch && s.GetRemaining() == 0 { // no target, or past it
+		return time.Time{}
+	}
+	return time.Now().Add(s.GetRemaining()).Round(time.Second)
 }
 
-func (s *State) SetStart(v time.Time)        { s.TimeStart = v }
-func (s *State) SetPause(v time.Time)        { s.TimePause = v }
-func (s *State) SetInterval(v time.Duration) { s.TimeInterval = v }
-func (s *State) SetBreak(v time.Duration)    { s.TimeBreak = v }
-func (s *State) SetAlert(v time.Duration)    { s.TimeAlert = v }
-func (s *State) SetTask(v string)            { s.Task = v }
+func (s *State) SetStart(v time.Time)         { s.TimeStart = v }
+func (s *State) SetPause(v time.Time)         { s.TimePause = v }
+func (s *State) SetBreak(v time.Duration)     { s.TimeBreak = v; s.BreakUntil = time.Time{} }
+func (s *State) SetBreakUntil(v time.Time)    { s.BreakUntil = v }
+func (s *State) SetLongBreak(v time.Duration) { s.TimeLongBreak = v }
+func (s *State) SetCycle(v int)               { s.Cycle = v; s.Count = 0 }
+func (s *State) SetTask(v string)             { s.Task = v }
+
+// setting the timer length leaves a running routine
+func (s *State) SetInterval(v time.Duration) {
+	s.TimeInterval = v
+	s.Until = time.Time{}
+	s.ClearRoutine()
+}
+
+func (s *State) SetUntil(v time.Time) {
+	s.Until = v
+	s.ClearRoutine()
+}
 
 func (s *State) ClearTask() error { // return nil error to satisfy map[string]func() err
 	s.Task = ""
@@ -123,6 +451,7 @@ func (s *State) Unmarshal(bytes []byte) error {
 	}
 	return nil
 }
+
 // convert state structure to bytes
 func (s *State) Marshal() ([]byte, error) {
 	json, err := json.MarshalIndent(s, "", "\t")
@@ -142,18 +471,12 @@ func (s *State) Save() error {
 		return err
 	}
 
-	path, err := os.UserCacheDir()
+	saveFile, err := StatePath(s.Name)
 	if err != nil {
-			s.Debug.Print("UserCacheDir() failed, using binary path", err)
-		path, err = os.Executable()
-		if err != nil {
-			s.Debug.Print("os.Executable() failed", err)
-			return err
-		}
+		s.Debug.Print("StatePath() failed", err)
+		return err
 	}
 
-	saveFile := filepath.Join(path, programName, StateFile)
-
 	_, err = checkFilePath(filepath.Dir(saveFile)) // is directory present
 	if err != nil {
 		err = createDirectory(filepath.Dir(saveFile))
@@ -172,28 +495,31 @@ func (s *State) Save() error {
 }
 
 func (s *State) Load() error {
-	var path, loadFile string
-
-	path, err := os.UserCacheDir()
+	loadFile, err := StatePath(s.Name)
 	if err != nil {
-		s.Debug.Print("UserCacheDir() failed, using binary path", err)
-		path, err = os.Executable()
-		if err != nil {
-			s.Debug.Print("os.Executable() failed to get binary path", err)
-			return err
-		}
+		s.Debug.Print("StatePath() failed", err)
+		return err
 	}
-
-	loadFile = filepath.Join(path, programName, StateFile)
 	bytes, err := readFile(loadFile)
 	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", programName, err)
+		}
 		s.UseDefaults()
 		return nil // using defaults corrects read error
 	}
 	err = s.Unmarshal(bytes)
 	if err != nil {
+		reportCorrupt(loadFile, err)
 		s.UseDefaults()
 		return nil // using defaults corrects unmarshal error
 	}
 	return nil
 }
+
+// replace the state with the contents of the state file
+func (s *State) Reload() {
+	fresh := State{Name: s.Name, Debug: s.Debug}
+	fresh.Load()
+	*s = fresh
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var errStopwatch = errors.New("not available while the stopwatch is running")
+
+// time counted by the stopwatch, pauses excluded
+func (s *State) GetStopwatchElapsed() time.Duration {
+	if s.TimerIsStopped() {
+		return 0
+	}
+	if s.TimerIsPaused() {
+		return s.TimePause.Sub(s.TimeStart)
+	}
+	return time.Since(s.TimeStart)
+}
+
+// time since the last lap, or since the start before the first lap
+func (s *State) GetLapElapsed() time.Duration {
+	if len(s.Laps) == 0 {
+		return s.GetStopwatchElapsed()
+	}
+	return s.GetStopwatchElapsed() - s.Laps[len(s.Laps)-1]
+}
+
+// length of lap n, counting from zero
+func (s *State) GetLap(n int) time.Duration {
+	if n == 0 {
+		return s.Laps[0]
+	}
+	return s.Laps[n] - s.Laps[n-1]
+}
+
+// fraction of the optional soft target, the stopwatch keeps running past it
+func (s *State) GetStopwatchProgress() float64 {
+	if s.Target <= 0 {
+		return 0
+	}
+	progress := float64(s.GetStopwatchElapsed()) / float64(s.Target)
+	if progress > 1 {
+		return 1
+	}
+	return progress
+}
+
+func (s *State) ClearStopwatch() {
+	s.Stopwatch = false
+	s.Target = 0
+	s.Laps = nil
+}
+
+// count up from zero with no interval, the target only fills the progress bar
+func (t *Task) StartStopwatch(target time.Duration) error {
+	t.EndSession()
+	t.State.ClearRoutine()
+	t.State.ClearUntil()
+	t.State.ClearStopwatch()
+	t.State.Stopwatch = true
+	t.State.Target = target
+	t.State.SetStart(time.Now())
+	t.State.SetPause(time.Time{})
+	err := t.State.Save()
+	if err != nil {
+		t.State.Debug.Print("StartStopwatch()", err)
+		return err
+	}
+	t.Message("stopwatch")
+	t.QueueHook(hookStart)
+	return nil
+}
+
+// record the split time of the running stopwatch
+func (t *Task) Lap() error {
+	if !t.State.Stopwatch || t.State.TimerIsStopped() {
+		return errors.New("stopwatch is not running")
+	}
+	t.State.Laps = append(t.State.Laps, t.State.GetStopwatchElapsed())
+	err := t.State.Save()
+	if err != nil {
+		t.State.Debug.Print("Lap()", err)
+		return err
+	}
+	t.Message(fmt.Sprintf("lap %d %v", len(t.State.Laps), t.State.GetLap(len(t.State.Laps)-1).Round(time.Second)))
+	return nil
+}
+
+// current lap number and time, shown once the first lap is recorded
+func (t *Task) DrawLap() string {
+	if !t.State.Stopwatch || t.State.TimerIsStopped() || len(t.State.Laps) == 0 || t.Config.HideTime {
+		return ""
+	}
+	lap := fmt.Sprintf("L%d %v", len(t.State.Laps)+1, t.FormatTime(t.State.GetLapElapsed()))
+	return fmt.Sprintf(" %v", t.Paint("time", lap))
+}
+
+// recorded laps for status, e.g. "laps 02:00 03:10 "
+func (t *Task) StopwatchState() string {
+	if len(t.State.Laps) == 0 {
+		return "stopwatch "
+	}
+	var laps []string
+	for n := range t.State.Laps {
+		laps = append(laps, t.FormatTime(t.State.GetLap(n)))
+	}
+	return fmt.Sprintf("stopwatch laps %v ", strings.Join(laps, " "))
+}
+
+// total, target and one line per lap with its length and split time
+func (t *Task) StopwatchInfo() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "stopwatch %v", t.State.GetStopwatchElapsed().Round(time.Second))
+	if t.State.Target > 0 {
+		fmt.Fprintf(&b, " target %v", t.State.Target)
+	}
+	b.WriteString("\n")
+	for n, split := range t.State.Laps {
+		fmt.Fprintf(&b, "lap %d %v %v\n", n+1, t.State.GetLap(n).Round(time.Second), split.Round(time.Second))
+	}
+	return b.String()
+}
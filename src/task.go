@@ -2,16 +2,24 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"strings"
+	"sync"
 	Tmux "terminalTimer/tmuxmenu"
 	"time"
 )
 
-// create timer object, load state, config, and adjust timer values based on config
+// create timer object for the timer selected with -name
 func InitializeTimer() (Task, error) {
+	return InitializeNamedTimer(timerName)
+}
+
+// create timer object, load state, config, and adjust timer values based on config
+func InitializeNamedTimer(name string) (Task, error) {
 	var t Task
 	var err error
 
-	t.State, err = InitializeState()
+	t.State, err = InitializeState(name)
 	if err != nil {
 		// this should never != nil, but we log if something went wrong
 		t.State.Debug.Print(t.State.Debug.Trace(), err)
@@ -20,7 +28,9 @@ func InitializeTimer() (Task, error) {
 	if err != nil {
 		t.State.Debug.Print(t.State.Debug.Trace(), err)
 	}
+	t.Hooks = new([]HookRun)
 	t.LoadSymbols()
+	t.LoadTheme()
 	t.LoadInputMaps()
 	t.Tmux = Tmux.Initialize()
 	if t.Config.Log { // defaults to false, must be explicitly set to true
@@ -41,14 +51,22 @@ type Task struct {
 	Tmux   *Tmux.Menu
 	Log    *History
 
-	Symbols  map[string]string              // icon symbols
-	Progress map[string]string              // progress bar characters
-	Command  map[string]func() error        // timer command map
-	Duration map[string]func(time.Duration) // set duration map
-	Toggle   map[string]func(state bool)    // set boolean settings map
-	Option   map[string]func(int)           // set integer settings map
-	Status   map[string]func() string       // timer status map
-	Display  map[string]func(string)        // display task string
+	Theme     Theme                                // colors per phase, nil when color is disabled
+	ColorMode string                               // ansi, tmux or none
+	Symbols   map[string]string                    // icon symbols
+	Progress  map[string]string                    // progress bar characters
+	Command   map[string]func() error              // timer command map
+	Duration  map[string]func(time.Duration)       // set duration map
+	Durations map[string]func([]time.Duration)     // set duration list map
+	Until     map[string]func(time.Time)           // set wall clock target map
+	Adjust    map[string]func(time.Duration) error // change the running interval or break
+	Toggle    map[string]func(state bool)          // set boolean settings map
+	Option    map[string]func(int)                 // set integer settings map
+	Status    map[string]func() string             // timer status map
+	Details   map[string]func() any                // machine readable timer status map
+	Display   map[string]func(string)              // display task string
+	Fired     []string                             // events fired by this process in the last update
+	Hooks     *[]HookRun                           // hooks queued by this process, shared with the bound command maps
 }
 
 func (t *Task) LoadSymbols() {
@@ -73,22 +91,135 @@ func (t *Task) LoadSymbols() {
 		t.Progress = bar_shade_rev
 	case t.Config.BarStyle == 5:
 		t.Progress = bar_ascii
+	case t.Config.BarStyle == 6:
+		t.Progress = bar_smooth
+	case t.Config.BarStyle == 7:
+		t.Progress = bar_vertical
+	case t.Config.BarStyle == 8:
+		t.Progress = bar_braille
 	default:
 		t.Progress = bar_solid
 	}
+	if t.Config.IconName != "" {
+		set, ok := t.Config.GetIconSet(t.Config.IconName)
+		if !ok {
+			warnSymbols(fmt.Sprintf("icon set %v is not defined", t.Config.IconName))
+		} else {
+			var missing []string
+			t.Symbols, missing = MergeSymbols(set, t.Symbols, iconKeys)
+			if len(missing) > 0 {
+				warnSymbols(fmt.Sprintf("icon set %v is missing %v", t.Config.IconName, strings.Join(missing, ", ")))
+			}
+		}
+	}
+	if t.Config.BarName != "" {
+		style, ok := t.Config.GetBarStyle(t.Config.BarName)
+		if !ok {
+			warnSymbols(fmt.Sprintf("bar style %v is not defined", t.Config.BarName))
+		} else {
+			var missing []string
+			t.Progress, missing = MergeSymbols(style, t.Progress, barKeys)
+			if len(missing) > 0 {
+				warnSymbols(fmt.Sprintf("bar style %v is missing %v", t.Config.BarName, strings.Join(missing, ", ")))
+			}
+		}
+	}
+}
+
+// warnings already printed, the timer is loaded again on every tick of run and every daemon request
+var symbolWarnings sync.Map
+
+// print a problem with the selected icon set or bar style once per process
+func warnSymbols(warning string) {
+	if _, printed := symbolWarnings.LoadOrStore(warning, true); printed {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%v: %v, using the default symbols for them\n", programName, warning)
 }
 
 // handle notification and restart events
 func (t *Task) GetTime() {
-	if t.State.TimerHasExpired() {
-		if t.Config.Restart {
-			t.Start() // restart
+	t.Fired = nil
+	t.Update(func() error {
+		if t.RecordSessions() {
+			t.State.Save()
 		}
+		t.UpdateEvents()
+		return nil
+	})
+}
+
+// read-modify-write of the timer state while holding the state file lock; the state is reloaded
+// first so changes saved by other processes are not overwritten
+func (t *Task) Update(change func() error) error {
+	defer t.RunHooks() // deferred first so hooks run after the lock is released
+	path, err := StatePath(t.State.Name)
+	if err != nil {
+		return err
+	}
+	unlock, err := LockFile(path)
+	if err != nil {
+		t.State.Debug.Print("Update() lock", err)
+	} else {
+		defer unlock()
+	}
+	t.State.Reload()
+	return change()
+}
+
+// change and save the configuration while holding the config file lock, nothing is saved when the
+// configuration file can not be read
+func (t *Task) UpdateConfig(change func() error) error {
+	path, err := ConfigPath()
+	if err != nil {
+		return err
 	}
-	t.NotificationUpdate() // check notification status
+	unlock, err := LockFile(path)
+	if err != nil {
+		t.State.Debug.Print("UpdateConfig() lock", err)
+	} else {
+		defer unlock()
+	}
+	config := Config{Debug: t.Config.Debug}
+	err = config.Load()
+	if os.IsNotExist(err) {
+		config.UseDefaults()
+	} else if err != nil {
+		return err
+	}
+	*t.Config = config
+	err = change()
+	if err != nil {
+		return err
+	}
+	return t.Config.Save()
 }
 
 func (t *Task) Start() error {
+	return t.startInterval(hookStart)
+}
+
+// start the next interval when the break is over and restart is enabled
+func (t *Task) Restart() error {
+	return t.startInterval(hookRestart)
+}
+
+func (t *Task) startInterval(hook string) error {
+	t.EndSession()
+	t.State.ClearStopwatch() // start always runs the countdown
+	if t.State.InRoutine() || t.State.TimerIsStopped() {
+		t.State.ClearRoutine() // start runs the timer, a routine is started with routine
+		t.State.Count = 0      // a fresh start begins the cycle with its first interval
+	} else if t.State.TimerOnBreak() || t.State.TimerHasExpired() { // previous interval was completed
+		t.State.NextCycle()
+		t.State.ClearUntil()
+	}
+	if t.State.Until.Before(time.Now()) { // a target that has passed does not carry over
+		t.State.Until = time.Time{}
+	}
+	if t.State.BreakUntil.Before(time.Now()) {
+		t.State.BreakUntil = time.Time{}
+	}
 	t.State.SetStart(time.Now())
 	t.State.SetPause(time.Time{})
 	err := t.State.Save()
@@ -97,18 +228,24 @@ func (t *Task) Start() error {
 		return err
 	}
 	t.Message("start")
+	t.QueueHook(hook)
 	return nil
 }
 
 func (t *Task) Stop() error {
+	t.EndSession()
 	t.State.SetStart(time.Time{})
 	t.State.SetPause(time.Time{})
+	t.State.Count = 0 // stopping the timer abandons the current cycle
+	t.State.ClearRoutine()
+	t.State.ClearUntil()
 	err := t.State.Save()
 	if err != nil {
 		t.State.Debug.Print("Stop()", err)
 		return err
 	}
 	t.Message("stop")
+	t.QueueHook(hookStop)
 	return nil
 }
 
@@ -129,31 +266,52 @@ func (t *Task) Pause() error {
 		return err
 	}
 	t.Message("pause")
+	t.QueueHook(hookPause)
 	return nil
 }
 
+// move the start time forward by the running pause and account it to the interval or break
+func (s *State) EndPause() {
+	if !s.TimerIsPaused() {
+		return
+	}
+	pauseDuration := time.Since(s.TimePause)
+	if s.TimerOnBreak() {
+		s.PausedBreak += pauseDuration
+	} else {
+		s.PausedInterval += pauseDuration
+	}
+	s.TimeStart = s.TimeStart.Add(pauseDuration)
+	s.TimePause = time.Time{}
+}
+
 func (t *Task) Resume() error {
 	if !t.State.TimerIsPaused() {
 		t.State.Debug.Print("Resume(): timer not paused")
 		return nil
 	}
-	pauseDuration := time.Since(t.State.TimePause)
-	adjustedStart := t.State.TimeStart.Add(pauseDuration)
-	t.State.TimeStart = adjustedStart
-	t.State.TimePause = time.Time{}
+	t.State.EndPause()
 	err := t.State.Save()
 	if err != nil {
 		t.State.Debug.Print("Resume() t.State.Save() error", err)
 		return err
 	}
 	t.Message("resume")
+	t.QueueHook(hookResume)
 	return nil
 }
 
 func (t *Task) Break() error {
+	if t.State.Stopwatch {
+		return errStopwatch
+	}
+	t.EndSession() // interval is cut short by the break
+	t.State.Recorded = phaseWork
+	t.State.Until = time.Time{} // the interval no longer runs to its target
 	oldtime := t.State.TimeStart
 	t.State.SetPause(time.Time{})
-	t.State.SetStart(time.Now().Add(-t.State.TimeInterval)) // set start time to (time now - interval)
+	t.State.SetStart(time.Now().Add(-t.State.GetInterval())) // set start time to (time now - interval)
+	t.State.NotifiedInterval = t.State.GetWorkEnd()          // cut short, the interval end is not fired
 	dur := oldtime.Sub(t.State.TimeStart)
 	t.State.Debug.Print("BREAK remaining time: ", dur)
 	err := t.State.Save()
@@ -162,6 +320,7 @@ func (t *Task) Break() error {
 		return err
 	}
 	t.Message("break")
+	t.QueueHook(hookBreakStart)
 	return nil
 }
 
@@ -172,118 +331,67 @@ func (t *Task) Clear() error {
 		t.State.Debug.Print("Clear() t.State.Save() error", err)
 		return err
 	}
+	t.QueueHook(hookTaskChange)
 	return nil
 }
 
 func (t *Task) Info() string {
-	return fmt.Sprintf("%v %v\n", t.State.TimeInterval, t.State.TimeBreak)
+	if t.State.Stopwatch {
+		return t.StopwatchInfo()
+	}
+	return fmt.Sprintf("%v %v\n", t.State.GetInterval().Round(time.Second), t.State.GetBreak().Round(time.Second))
 }
 
 func (t *Task) GetState() string {
-	var state, notify, restart, task string
-	switch {
-	case t.State.TimerHasExpired():
-		state = stateString["expired"]
-	case t.State.TimerIsStopped():
-		state = stateString["stopped"]
-	case t.State.TimerOnBreak():
-		if t.State.TimerIsPaused() {
-			state = stateString["breakp"]
-		} else {
-			state = stateString["break"]
-		}
-	case !t.State.TimerIsStopped():
-		if t.State.TimerIsPaused() {
-			state = stateString["paused"]
-		} else {
-			state = stateString["on"]
-		}
-	}
+	var cycle, end, notify, restart, task string
+	state := stateString[t.State.GetPhase()]
 	if t.Config.Restart {
-		restart = fmt.Sprintf("%v ",t.Symbols["restart"])
+		restart = fmt.Sprintf("%v ", t.Symbols["restart"])
 	}
-	if t.Config.Notify {
-		notify = fmt.Sprintf("%v ",t.Symbols["notify"])
+	if len(t.Config.Notifiers) > 0 {
+		notify = fmt.Sprintf("%v ", t.Symbols["notify"])
 	}
 	if len(t.State.Task) > 0 {
 		task = t.State.Task + " "
 	}
-	return fmt.Sprintf("%v%v %v%v", task, state, restart, notify)
-}
-
-func (t *Task) NotificationUpdate() {
-	const notifyThreshold = 1000 * time.Millisecond
-	if t.State.TimerIsPaused() { // don't send notifications if paused
-		return
+	if t.State.Stopwatch {
+		cycle = t.StopwatchState()
+	} else if phase, ok := t.State.CurrentPhase(); ok {
+		cycle = fmt.Sprintf("%v %d/%d ", phase.Name, t.State.Phase+1, len(t.State.Phases))
+	} else if t.State.Cycle > 0 && !t.State.TimerIsStopped() {
+		cycle = t.State.GetCycle() + " "
 	}
-	var message string
-	switch {
-	case t.State.TimerOnBreak():
-		if (t.State.GetTotal()-t.State.GetElapsed()) < time.Duration(notifyThreshold) && (t.State.GetTotal()-t.State.GetElapsed()) > time.Duration(0*time.Second) {
-			message = messageDone
-			if t.Config.Restart {
-				message = messageWork
-			}
-			t.SendNotification(message)
-			t.SendTmuxNotification(message)
-			t.Message("break over")
-			return
-		}
-	case !t.State.TimerOnBreak():
-		if t.State.GetIntervalRemaining() < time.Duration(notifyThreshold) && t.State.GetIntervalRemaining() > time.Duration(0*time.Second) {
-			message = messageBreak
-			t.SendNotification(message)
-			t.SendTmuxNotification(message)
-			t.Message("completed")
-			return
-		}
+	if until := t.DrawEnd(); until != "" {
+		end = fmt.Sprintf("ends %v ", until)
 	}
+	return fmt.Sprintf("%v%v %v%v%v%v", task, state, cycle, end, restart, notify)
 }
 
-func (t *Task) SendNotification(message string) {
-	if !t.Config.Notify {
-		return
+// returns if the phase that follows the current one is a break
+func (t *Task) NextIsBreak() bool {
+	if t.State.InRoutine() {
+		next, ok := t.State.PeekPhase(t.Config.Restart)
+		return ok && next.IsBreak()
 	}
-	if !t.State.TimerOnBreak() {
-		message = messageBreak
-	} else {
-		message = messageDone
-		if t.Config.Restart {
-			message = messageWork
-		}
-	}
-	err := NotifySend(message)
-	if err != nil {
-		message = err.Error() // show err in debug log
-	}
-	t.State.Debug.Print("NOTIFY-SEND:", message)
+	return !t.State.TimerOnBreak() && !t.State.TimerHasExpired()
 }
 
-func (t *Task) SendTmuxNotification(message string) {
-	var title, symbol string
-	if !t.Config.NotifyTmux {
-		return
-	}
-	if !t.State.TimerOnBreak() {
-		message = messageBreak
-		symbol = t.Symbols["break"]
-	} else {
-		message = messageDone
-		symbol = t.Symbols["on"]
-		if t.Config.Restart { // restarting timer displays a different message
-			message = messageWork
+// message describing what follows the current interval, break or routine phase
+func (t *Task) NextMessage() string {
+	if t.State.InRoutine() {
+		next, ok := t.State.PeekPhase(t.Config.Restart)
+		if !ok {
+			return messageDone
 		}
+		return fmt.Sprintf(messagePhase, next.Name, next.Duration)
 	}
-	title = fmt.Sprintf(" %v %v %v ", symbol, "Notification", symbol)
-	err := t.Tmux.Close() // close any existing tmux popup before spawning a new one
-	if err != nil {
-		t.State.Debug.Print("TMUX CLOSE POPUP:", err)
+	if !t.State.TimerOnBreak() && !t.State.TimerHasExpired() {
+		return messageBreak
 	}
-	err = t.Tmux.Open(title, message)
-	if err != nil {
-		t.State.Debug.Print("TMUX OPEN POPUP:", err)
+	if t.Config.Restart { // restarting timer displays a different message
+		return messageWork
 	}
-	t.State.Debug.Print("TMUX NOTIFICATION:", message)
+	return messageDone
 }
 
 func (t *Task) FormatTime(remaining time.Duration) (result string) {
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const endTimeFormat = "15:04"
+
+// values available to format templates, e.g. "{icon} {task}[ ({cycle})] {time}"
+func (t *Task) Placeholders() map[string]func() string {
+	return map[string]func() string{
+		"icon":    t.DrawIcon,
+		"task":    t.DrawTask,
+		"bar":     t.DrawBar,
+		"time":    t.DrawTime,
+		"percent": t.DrawPercent,
+		"state":   func() string { return stateString[t.State.GetPhase()] },
+		"cycle":   t.DrawCycle,
+		"end":     t.DrawEnd,
+		"name":    t.State.GetName,
+		"elapsed": t.DrawElapsed,
+		"next":    t.DrawNext,
+	}
+}
+
+// time spent in the interval or break in progress
+func (t *Task) DrawElapsed() string {
+	if t.State.TimerIsStopped() {
+		return ""
+	}
+	return t.FormatTime(t.State.GetPhaseElapsed())
+}
+
+// length of the phase that follows the current one
+func (t *Task) DrawNext() string {
+	next := t.State.NextLength(t.Config.Restart)
+	if next <= 0 {
+		return ""
+	}
+	return t.FormatTime(next)
+}
+
+// position in the routine or long break cycle
+func (t *Task) DrawCycle() string {
+	if t.State.TimerIsStopped() {
+		return ""
+	}
+	if _, ok := t.State.CurrentPhase(); ok {
+		return fmt.Sprintf("%d/%d", t.State.Phase+1, len(t.State.Phases))
+	}
+	return t.State.GetCycle()
+}
+
+// projected wall clock time the current interval or break ends
+func (t *Task) DrawEnd() string {
+	end := t.State.GetEnd()
+	if end.IsZero() {
+		return ""
+	}
+	return end.Format(endTimeFormat)
+}
+
+// the format passed with -format takes priority over the configured format
+func (t *Task) GetFormat() string {
+	if renderFormat != "" {
+		return renderFormat
+	}
+	return t.Config.Format
+}
+
+// replace {placeholders} in a format string; a [segment] is dropped when all of its placeholders are
+// empty, and a backslash escapes the next character
+func (t *Task) ExpandFormat(format string) string {
+	return ExpandTemplate(format, t.Placeholders())
+}
+
+// replace {placeholders} with the given values, following the rules of ExpandFormat
+func ExpandTemplate(format string, values map[string]func() string) string {
+	var out, segment strings.Builder
+	var inSegment, found, filled bool
+	current := &out
+	runes := []rune(format)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\' && i+1 < len(runes):
+			i++
+			current.WriteRune(runes[i])
+		case r == '[' && !inSegment:
+			inSegment, found, filled = true, false, false
+			segment.Reset()
+			current = &segment
+		case r == ']' && inSegment:
+			if !found || filled {
+				out.WriteString(segment.String())
+			}
+			inSegment = false
+			current = &out
+		case r == '{':
+			end := strings.IndexRune(string(runes[i:]), '}')
+			if end < 0 {
+				current.WriteRune(r)
+				break
+			}
+			name := string(runes[i:])[1:end]
+			value, ok := values[name]
+			if !ok {
+				current.WriteRune(r) // unknown placeholders are printed as they are
+				break
+			}
+			text := strings.TrimSpace(value())
+			found = true
+			filled = filled || text != ""
+			current.WriteString(text)
+			i += len([]rune(name)) + 1
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if inSegment { // unterminated segment is printed as written
+		out.WriteRune('[')
+		out.WriteString(segment.String())
+	}
+	return out.String()
+}
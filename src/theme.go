@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	colorNone = "none"
+	colorAuto = "auto"
+	colorANSI = "ansi"
+	colorTmux = "tmux"
+
+	ansiReset = "\033[0m"
+	tmuxReset = "#[default]"
+)
+
+// foreground and background color: a name, a 256 color index or #rrggbb
+type Color struct {
+	Fg string `json:"fg,omitempty"`
+	Bg string `json:"bg,omitempty"`
+}
+
+// colors of each part of the timer in one phase
+type Palette struct {
+	Icon Color `json:"icon"`
+	Done Color `json:"done"`
+	Todo Color `json:"todo"`
+	Time Color `json:"time"`
+	Task Color `json:"task"`
+}
+
+// palettes keyed by phase: running, alert, paused, break, break-paused, expired and stopped
+type Theme map[string]Palette
+
+var colorNames = map[string]int{
+	"black": 0, "red": 1, "green": 2, "yellow": 3, "blue": 4, "magenta": 5, "cyan": 6, "white": 7,
+	"grey": 8, "brightred": 9, "brightgreen": 10, "brightyellow": 11, "brightblue": 12,
+	"brightmagenta": 13, "brightcyan": 14, "brightwhite": 15,
+}
+
+var builtinThemes = map[string]Theme{
+	"default": {
+		"running":      {Icon: Color{Fg: "green"}, Done: Color{Fg: "green"}, Todo: Color{Fg: "grey"}, Time: Color{Fg: "green"}},
+		"alert":        {Icon: Color{Fg: "yellow"}, Done: Color{Fg: "yellow"}, Todo: Color{Fg: "grey"}, Time: Color{Fg: "yellow"}},
+		"paused":       {Icon: Color{Fg: "grey"}, Done: Color{Fg: "grey"}, Todo: Color{Fg: "grey"}, Time: Color{Fg: "grey"}, Task: Color{Fg: "grey"}},
+		"break":        {Icon: Color{Fg: "cyan"}, Done: Color{Fg: "cyan"}, Todo: Color{Fg: "grey"}, Time: Color{Fg: "cyan"}},
+		"break-paused": {Icon: Color{Fg: "blue"}, Done: Color{Fg: "blue"}, Todo: Color{Fg: "grey"}, Time: Color{Fg: "grey"}, Task: Color{Fg: "grey"}},
+		"expired":      {Icon: Color{Fg: "red"}, Done: Color{Fg: "red"}, Time: Color{Fg: "red"}},
+		"stopped":      {Icon: Color{Fg: "grey"}, Task: Color{Fg: "grey"}},
+	},
+}
+
+// select the theme and color output, color is disabled by NO_COLOR, machine readable output,
+// and in auto mode when stdout is not a terminal
+func (t *Task) LoadTheme() {
+	t.ColorMode = colorNone
+	t.Theme = nil
+	if t.Config.Theme == "" || os.Getenv("NO_COLOR") != "" || renderOutput != "" {
+		return
+	}
+	theme, ok := t.Config.Themes[t.Config.Theme]
+	if !ok {
+		theme, ok = builtinThemes[t.Config.Theme]
+	}
+	if !ok {
+		t.State.Debug.Print("LoadTheme(): unknown theme", t.Config.Theme)
+		return
+	}
+	mode := t.Config.ColorMode
+	if renderColor != "" {
+		mode = renderColor
+	}
+	switch mode {
+	case colorANSI, colorTmux:
+		t.ColorMode = mode
+	case colorAuto, "":
+		if IsTerminal(os.Stdout) {
+			t.ColorMode = colorANSI
+		}
+	}
+	t.Theme = theme
+}
+
+// returns if the file is a character device, e.g. not a pipe or regular file
+func IsTerminal(file *os.File) bool {
+	stat, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
+// theme key of the current phase, following the icon selection of DrawIcon
+func (t *Task) ThemePhase() string {
+	switch {
+	case t.State.TimerIsStopped():
+		return "stopped"
+	case t.State.TimerHasExpired():
+		return "expired"
+	case t.State.TimerIsPaused() && t.State.TimerOnBreak():
+		return "break-paused"
+	case t.State.TimerIsPaused():
+		return "paused"
+	case t.State.TimerOnBreak():
+		return "break"
+	case t.State.TimerOnAlert():
+		return "alert"
+	default:
+		return "running"
+	}
+}
+
+// wrap text in the theme color of a timer part: icon, done, todo, time or task
+func (t *Task) Paint(part, text string) string {
+	if t.ColorMode == colorNone || t.ColorMode == "" || text == "" {
+		return text
+	}
+	palette, ok := t.Theme[t.ThemePhase()]
+	if !ok {
+		return text
+	}
+	var color Color
+	switch part {
+	case "icon":
+		color = palette.Icon
+	case "done":
+		color = palette.Done
+	case "todo":
+		color = palette.Todo
+	case "time":
+		color = palette.Time
+	case "task":
+		color = palette.Task
+	}
+	if color.Fg == "" && color.Bg == "" {
+		return text
+	}
+	if t.ColorMode == colorTmux {
+		return fmt.Sprintf("%v%v%v", tmuxStyle(color), text, tmuxReset)
+	}
+	return fmt.Sprintf("%v%v%v", ansiStyle(color), text, ansiReset)
+}
+
+// escape sequence for a color, 256 color indexes and #rrggbb truecolor
+func ansiStyle(c Color) string {
+	var codes []string
+	if fg := ansiColor(c.Fg); fg != "" {
+		codes = append(codes, "38;"+fg)
+	}
+	if bg := ansiColor(c.Bg); bg != "" {
+		codes = append(codes, "48;"+bg)
+	}
+	if len(codes) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\033[%vm", strings.Join(codes, ";"))
+}
+
+func ansiColor(value string) string {
+	if r, g, b, ok := parseHexColor(value); ok {
+		return fmt.Sprintf("2;%d;%d;%d", r, g, b)
+	}
+	if index, ok := parseColorIndex(value); ok {
+		return fmt.Sprintf("5;%d", index)
+	}
+	return ""
+}
+
+// tmux status line markup for a color, e.g. #[fg=colour2,bg=#1d2021]
+func tmuxStyle(c Color) string {
+	var styles []string
+	if fg := tmuxColor(c.Fg); fg != "" {
+		styles = append(styles, "fg="+fg)
+	}
+	if bg := tmuxColor(c.Bg); bg != "" {
+		styles = append(styles, "bg="+bg)
+	}
+	if len(styles) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("#[%v]", strings.Join(styles, ","))
+}
+
+func tmuxColor(value string) string {
+	if _, _, _, ok := parseHexColor(value); ok {
+		return strings.ToLower(value)
+	}
+	if index, ok := parseColorIndex(value); ok {
+		return fmt.Sprintf("colour%d", index)
+	}
+	return ""
+}
+
+func parseHexColor(value string) (r, g, b int, ok bool) {
+	if len(value) != 7 || value[0] != '#' {
+		return 0, 0, 0, false
+	}
+	v, err := strconv.ParseUint(value[1:], 16, 32)
+	if err != nil {
+		return 0, 0, 0, false
+	}
+	return int(v >> 16 & 0xff), int(v >> 8 & 0xff), int(v & 0xff), true
+}
+
+func parseColorIndex(value string) (int, bool) {
+	if index, ok := colorNames[strings.ToLower(value)]; ok {
+		return index, true
+	}
+	index, err := strconv.Atoi(value)
+	if err != nil || index < 0 || index > 255 {
+		return 0, false
+	}
+	return index, true
+}
@@ -0,0 +1,91 @@
+package main
+
+import "time"
+
+// events the wait command blocks on, in the order they are checked, with the exit code reporting
+// each one when several events are awaited
+var waitOrder = []string{"alert", "break", "end", "expired", "stopped"}
+var waitEvents = map[string]int{
+	"alert":   3, // an alert threshold of the interval or break is reached
+	"break":   4, // the interval ends and the break starts
+	"end":     5, // the break ends, or the interval when there is no break
+	"expired": 6, // the timer completes without restarting
+	"stopped": 7,
+}
+
+const (
+	waitTick    = 1 * time.Second
+	exitTimeout = 124 // same as timeout(1)
+)
+
+// phase of the timer as seen by one check of the wait command
+type waitView struct {
+	onBreak  bool
+	expired  bool
+	stopped  bool
+	interval time.Time // last interval end fired
+	brk      time.Time // last break end fired
+	alert    time.Time // last alert fired
+}
+
+func (s *State) waitView() waitView {
+	return waitView{
+		onBreak:  s.TimerOnBreak(),
+		expired:  s.TimerHasExpired(),
+		stopped:  s.TimerIsStopped(),
+		interval: s.NotifiedInterval,
+		brk:      s.NotifiedBreak,
+		alert:    s.NotifiedAlert,
+	}
+}
+
+// events that happened since the previous check; the fired event times catch ends that pass
+// between checks, e.g. a break end followed by a restart
+func (v waitView) events(prev waitView) map[string]bool {
+	ended := v.brk.After(prev.brk)
+	return map[string]bool{
+		"alert":   v.alert.After(prev.alert),
+		"break":   (v.onBreak && !prev.onBreak) || (v.interval.After(prev.interval) && !ended),
+		"end":     ended || (v.expired && !prev.expired),
+		"expired": v.expired && !prev.expired,
+		"stopped": v.stopped && !prev.stopped,
+	}
+}
+
+// block until one of the events happens to the named timer and return it, or return an empty
+// string once the timeout has passed; a zero timeout waits forever. The state is read again on
+// every check, so pauses and changes made by other processes are followed
+func WaitEvent(name string, events []string, timeout time.Duration) string {
+	t, _ := InitializeNamedTimer(name)
+	t.GetTime()
+	prev := t.State.waitView()
+
+	tick := time.NewTicker(waitTick)
+	defer tick.Stop()
+	changed, err := WatchFiles(WatchDirectories()...) // nil channel when polling
+	if err != nil {
+		t.State.Debug.Print("WaitEvent(): polling for changes,", err)
+	}
+	var expire <-chan time.Time
+	if timeout > 0 {
+		expire = time.After(timeout)
+	}
+	for {
+		select {
+		case <-expire:
+			return ""
+		case <-tick.C:
+		case <-changed:
+		}
+		t, _ = InitializeNamedTimer(name)
+		t.GetTime()
+		current := t.State.waitView()
+		happened := current.events(prev)
+		for _, event := range events {
+			if happened[event] {
+				return event
+			}
+		}
+		prev = current
+	}
+}
@@ -0,0 +1,80 @@
+//go:build linux
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// inotify events of a file written in place or renamed into the directory, e.g. by writeFile
+const watchEvents = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_DELETE
+
+// send on the returned channel when a json file in one of the directories changes; pending changes
+// are merged so a burst of writes causes one reload
+func WatchFiles(dirs ...string) (<-chan struct{}, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	var watched int
+	for _, dir := range dirs {
+		_, err = checkFilePath(dir)
+		if err != nil {
+			err = createDirectory(dir)
+			if err != nil {
+				continue
+			}
+		}
+		_, err = syscall.InotifyAddWatch(fd, dir, watchEvents)
+		if err == nil {
+			watched++
+		}
+	}
+	if watched == 0 {
+		syscall.Close(fd)
+		return nil, err
+	}
+	changed := make(chan struct{}, 1)
+	go func() {
+		buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+		for {
+			n, err := syscall.Read(fd, buf)
+			if err == syscall.EINTR {
+				continue
+			}
+			if err != nil || n <= 0 {
+				syscall.Close(fd)
+				return
+			}
+			if watchedChange(buf[:n]) {
+				select {
+				case changed <- struct{}{}:
+				default: // a reload is already pending
+				}
+			}
+		}
+	}()
+	return changed, nil
+}
+
+// returns if any event in the buffer names a state or config file, log files and lock files are
+// written constantly and ignored
+func watchedChange(buf []byte) bool {
+	for offset := 0; offset+syscall.SizeofInotifyEvent <= len(buf); {
+		event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+		start := offset + syscall.SizeofInotifyEvent
+		end := start + int(event.Len)
+		if end > len(buf) {
+			return false
+		}
+		name := strings.TrimRight(string(buf[start:end]), "\x00")
+		if filepath.Ext(name) == ".json" {
+			return true
+		}
+		offset = end
+	}
+	return false
+}
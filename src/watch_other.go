@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// file watching uses inotify, other systems fall back to polling
+func WatchFiles(dirs ...string) (<-chan struct{}, error) {
+	return nil, errors.New("file watching is not supported on this system")
+}